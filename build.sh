@@ -6,8 +6,11 @@ if [ "$#" -lt 3 ]; then
   exit 1
 fi
 
-# Cleanup existing directories
-sudo rm -rf db/
+# Cleanup existing directories. With "resume" as fourth argument the database is kept,
+# and the builder skips the graphs completed by the interrupted build.
+if [ "$4" != "resume" ]; then
+  sudo rm -rf db/
+fi
 sudo rm -rf target/
 sudo rm -rf bgw-*/
 
@@ -24,7 +27,18 @@ echo "Copy started with PID ${COPY_PID}"
 # Execute metadb-go in parallel to copying
 vospath="$2"
 vospath="${vospath%/}"
-./metadb-go -path=$vospath/uploads -t=$3
+./metadb-go -path=$vospath/uploads -t=$3 -version=$1
+status=$?
+if [ $status -ne 0 ]; then
+  if [ $status -eq 130 ]; then
+    echo "MetaDB build interrupted, run again with resume to continue it."
+  else
+    echo "MetaDB build failed with status $status."
+  fi
+  kill $COPY_PID 2>/dev/null
+  docker compose down
+  exit $status
+fi
 echo "Please wait for copy to finish."
 # Wait for the copy operation to complete
 wait $COPY_PID
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// checkpointCollection holds a document per completed unit of the build, a graph loaded for a taxon.
+// A restarted build skips the units completed from the same inputs.
+var checkpointCollection = "_checkpoints"
+
+// forceGraphs are the graphs loaded even if they have a checkpoint, given with -force. "all" forces every graph.
+var forceGraphs = map[string]bool{}
+
+// unitDependencies are the graphs whose input files a graph's documents depend on, through the refScores.
+// A unit is loaded again when the files of its dependencies changed.
+var unitDependencies = map[string][]string{
+	"gene":  {"prot"},
+	"omim":  {"gene2phen"},
+	"goall": {"prot2bp", "prot2cc", "prot2mf"},
+}
+
+// Checkpoint records that a graph was loaded for a taxon. Taxon is "" for the ontologies.
+type Checkpoint struct {
+	Graph  string      `bson:"graph"`
+	Taxon  string      `bson:"taxon"`
+	Inputs []InputFile `bson:"inputs"`
+	// Digest covers the checksums of the inputs and of the dependencies, and the manifest.
+	Digest    string    `bson:"digest"`
+	Completed time.Time `bson:"completed"`
+}
+
+func parseForceGraphs(value string) map[string]bool {
+	graphs := make(map[string]bool)
+	for _, graph := range strings.Split(value, ",") {
+		if graph = strings.TrimSpace(graph); graph != "" {
+			graphs[graph] = true
+		}
+	}
+	return graphs
+}
+
+// copiedUnits and parsedUnits list the units of this build, as graph/taxon, for the incremental summary.
+var copiedUnits, parsedUnits []string
+
+// runUnit loads a graph for a taxon with load, unless it was completed by an earlier run from files with the
+// same checksums, with the same dependencies and manifest. With a previous build, a unit it loaded from the same
+// inputs is copied from it instead. The state a skipped unit leaves for the later ones, its refScores and the URIs
+// used to find duplicates, is read back from the database. An error of load, like URIs already loaded from another
+// taxon with the error merge policy, is returned and the unit gets no checkpoint.
+func runUnit(ctx context.Context, client *mongo.Client, rdfPath string, graph string, taxon string, refScores map[string]int, load func() error) error {
+	stopIfInterrupted(ctx, client)
+	setCurrentStep(unitKey(graph, taxon))
+	db := client.Database("metadb")
+	filter := bson.M{"graph": graph, "taxon": taxon}
+	var checkpoint Checkpoint
+	err := db.Collection(checkpointCollection).FindOne(ctx, filter).Decode(&checkpoint)
+	if err != nil && err != mongo.ErrNoDocuments {
+		panic(err)
+	}
+	found := err == nil
+	previous, inPrevious := Checkpoint{}, false
+	if previousBuild != nil {
+		previous, inPrevious = previousBuild.units[unitKey(graph, taxon)]
+	}
+	dependencies := dependencyInputs(rdfPath, graph, taxon)
+
+	if (found || inPrevious) && !forceGraphs[graph] && !forceGraphs["all"] {
+		inputs, err := checksumFiles(unitFiles(rdfPath, graph, taxon), graph)
+		if err != nil {
+			slog.Error("Error reading the input files", "phase", "checkpoint", "graph", graph, "taxon", taxon, "err", err)
+		} else if digest := unitDigest(inputs, dependencies); found && digest == checkpoint.Digest {
+			slog.Info("Completed by an earlier run, skipping", "phase", "checkpoint", "graph", graph, "taxon", taxon, "completed", checkpoint.Completed)
+			return skipUnit(ctx, client, checkpoint, refScores)
+		} else if !found && inPrevious && digest == previous.Digest {
+			for _, collection := range unitCollections(graph) {
+				prepareCollection(ctx, client, collection)
+			}
+			if err := previousBuild.copyUnit(ctx, db, graph, taxon); err != nil {
+				panic(err)
+			}
+			checkpoint = Checkpoint{
+				Graph:     graph,
+				Taxon:     taxon,
+				Inputs:    withLines(inputs, previous.Inputs),
+				Digest:    digest,
+				Completed: time.Now().UTC(),
+			}
+			writeCheckpoint(ctx, db, checkpoint)
+			copiedUnits = append(copiedUnits, unitKey(graph, taxon))
+			return skipUnit(ctx, client, checkpoint, refScores)
+		}
+	}
+	if found {
+		slog.Info("Loading again, removing the documents of the earlier run", "phase", "checkpoint", "graph", graph, "taxon", taxon)
+		clearUnit(ctx, db, graph, taxon)
+	} else if inPrevious && taxon != "" {
+		// The merged documents copied with the units of other taxa still have this taxon from the previous build.
+		clearUnit(ctx, db, graph, taxon)
+	}
+
+	provenance.Lock()
+	before := len(provenance.inputs)
+	provenance.Unlock()
+	// A unit that fails gets no checkpoint either, and the build stops.
+	if err := load(); err != nil {
+		return err
+	}
+	// An interrupted unit gets no checkpoint, it is loaded again when the build is resumed.
+	stopIfInterrupted(ctx, client)
+	provenance.Lock()
+	inputs := append([]InputFile{}, provenance.inputs[before:]...)
+	provenance.Unlock()
+
+	writeCheckpoint(ctx, db, Checkpoint{
+		Graph:     graph,
+		Taxon:     taxon,
+		Inputs:    inputs,
+		Digest:    unitDigest(inputs, dependencies),
+		Completed: time.Now().UTC(),
+	})
+	parsedUnits = append(parsedUnits, unitKey(graph, taxon))
+	return nil
+}
+
+func writeCheckpoint(ctx context.Context, db *mongo.Database, checkpoint Checkpoint) {
+	_, err := db.Collection(checkpointCollection).ReplaceOne(
+		ctx,
+		bson.M{"graph": checkpoint.Graph, "taxon": checkpoint.Taxon},
+		checkpoint,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// skipUnit records the inputs of a unit that is not parsed, and restores the state it leaves for the later units.
+func skipUnit(ctx context.Context, client *mongo.Client, checkpoint Checkpoint, refScores map[string]int) error {
+	for _, input := range checkpoint.Inputs {
+		recordInput(input)
+	}
+	if err := restoreUnit(ctx, client.Database("metadb"), checkpoint.Graph, checkpoint.Taxon, refScores); err != nil {
+		return err
+	}
+	for _, collection := range unitCollections(checkpoint.Graph) {
+		prepareCollection(ctx, client, collection)
+	}
+	return nil
+}
+
+// withLines sets the line counts of inputs from the inputs of an earlier build with the same file name and checksum.
+func withLines(inputs []InputFile, earlier []InputFile) []InputFile {
+	for i, input := range inputs {
+		for _, e := range earlier {
+			if filepath.Base(e.Path) == filepath.Base(input.Path) && e.SHA256 == input.SHA256 {
+				inputs[i].Lines = e.Lines
+			}
+		}
+	}
+	return inputs
+}
+
+// unitFiles returns the input files a unit reads, like the parsers find them.
+func unitFiles(rdfPath string, graph string, taxon string) []string {
+	dir, pattern := rdfPath+"/"+graph, taxon
+	switch graph {
+	case "goall":
+		dir, pattern = rdfPath+"/onto", "go-basic"
+	case "omim":
+		dir, pattern = rdfPath+"/onto", "omim"
+	case "prot2prot":
+		pattern = "*" + taxon
+	}
+	// prot2prot reads a file per source. The other graphs read one file, findRDFFile refuses several.
+	files, err := globRDFFiles(dir, pattern)
+	if err != nil {
+		return nil
+	}
+	return files
+}
+
+// unitCollections are the collections a unit writes to.
+func unitCollections(graph string) []string {
+	switch collectionKinds[graph] {
+	case "entity":
+		return []string{graph, xrefCollection, publicationCollection}
+	case "ontology":
+		return []string{graph, xrefCollection}
+	default:
+		return []string{graph, publicationCollection}
+	}
+}
+
+// dependencyInputs returns the input files of a graph's dependencies read so far. A unit of a taxon only depends on
+// the files of the same taxon, the units without a taxon (goall and omim) on the files of all taxa.
+func dependencyInputs(rdfPath string, graph string, taxon string) []InputFile {
+	provenance.Lock()
+	defer provenance.Unlock()
+	inputs := []InputFile{}
+	for _, dependency := range unitDependencies[graph] {
+		files := make(map[string]bool)
+		for _, path := range unitFiles(rdfPath, dependency, taxon) {
+			files[path] = true
+		}
+		for _, input := range provenance.inputs {
+			if input.Collection == dependency && (taxon == "" || files[input.Path]) {
+				inputs = append(inputs, input)
+			}
+		}
+	}
+	return inputs
+}
+
+// checksumFiles reads files to compute their checksums and sizes.
+func checksumFiles(paths []string, collection string) ([]InputFile, error) {
+	inputs := []InputFile{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.New()
+		size, err := io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, InputFile{Path: path, Collection: collection, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))})
+	}
+	return inputs, nil
+}
+
+// inputName identifies an input file independently of the uploads folder, so builds of different versions
+// can be compared.
+func inputName(input InputFile) string {
+	return input.Collection + "/" + filepath.Base(input.Path)
+}
+
+// parseSettings are the settings of the manifest that change the documents the parsers write. The taxa, ranking,
+// text indexes and validation thresholds are left out: they do not change a unit's documents, and the passes that use
+// them run on every build.
+func parseSettings(m Manifest) interface{} {
+	return struct {
+		GraphRoutes    map[string]string
+		Languages      []string
+		LiteralFields  map[string]string
+		Autocomplete   AutocompleteConfig
+		MergePolicy    string
+		XrefPredicates map[string]string
+		Prefixes       map[string]string
+		PubMedRefs     bool
+	}{m.GraphRoutes, m.Languages, m.LiteralFields, m.Autocomplete, m.MergePolicy, m.XrefPredicates, m.Prefixes, m.PubMedRefs}
+}
+
+// unitDigest is the checksum of the names and checksums of a unit's inputs and dependencies, and of the parse
+// settings of the manifest.
+func unitDigest(inputs []InputFile, dependencies []InputFile) string {
+	lines := []string{}
+	for _, input := range inputs {
+		lines = append(lines, "input "+inputName(input)+" "+input.SHA256)
+	}
+	for _, input := range dependencies {
+		lines = append(lines, "dependency "+inputName(input)+" "+input.SHA256)
+	}
+	sort.Strings(lines)
+	content, err := json.Marshal(parseSettings(manifest))
+	if err != nil {
+		panic(err)
+	}
+	hash := sha256.New()
+	hash.Write(content)
+	for _, line := range lines {
+		hash.Write([]byte("\n" + line))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// unitFilter matches the documents of a unit, including the documents merged from several taxa that have its taxon
+// in their taxon array. Copying, restoring and clearing a unit all use it, so they act on the same documents.
+func unitFilter(taxon string) bson.M {
+	if taxon == "" {
+		return bson.M{}
+	}
+	return bson.M{"taxon": taxonPrefix + taxon}
+}
+
+// clearUnit removes the documents, cross-references and citations written by an earlier run of a unit.
+// Documents merged from several taxa are still needed by the other taxa, only the unit's taxon is removed from them.
+func clearUnit(ctx context.Context, db *mongo.Database, graph string, taxon string) {
+	xrefFilter := unitFilter(taxon)
+	xrefFilter["collection"] = graph
+	if taxon != "" {
+		removeMergedTaxon(ctx, db.Collection(graph), unitFilter(taxon), taxon)
+		removeMergedTaxon(ctx, db.Collection(xrefCollection), xrefFilter, taxon)
+	}
+	uris, err := unitURIs(ctx, db.Collection(graph), unitFilter(taxon))
+	if err != nil {
+		panic(err)
+	}
+	pullCitations(ctx, db, uris)
+	result, err := db.Collection(graph).DeleteMany(ctx, unitFilter(taxon))
+	if err != nil {
+		panic(err)
+	}
+	if _, err := db.Collection(xrefCollection).DeleteMany(ctx, xrefFilter); err != nil {
+		panic(err)
+	}
+	slog.Info("Removed documents", "phase", "checkpoint", "graph", graph, "taxon", taxon, "count", result.DeletedCount)
+}
+
+// removeMergedTaxon removes a taxon from the taxon arrays of the merged documents matching filter. A document left
+// with one taxon gets it as a string again, like taxonField writes it.
+func removeMergedTaxon(ctx context.Context, collection *mongo.Collection, filter bson.M, taxon string) {
+	merged := bson.M{"taxon.1": bson.M{"$exists": true}}
+	for key, value := range filter {
+		merged[key] = value
+	}
+	rest := bson.M{"$filter": bson.M{
+		"input": "$taxon",
+		"cond":  bson.M{"$ne": bson.A{"$$this", taxonPrefix + taxon}},
+	}}
+	_, err := collection.UpdateMany(ctx, merged, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"taxon": bson.M{"$let": bson.M{
+			"vars": bson.M{"rest": rest},
+			"in": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{bson.M{"$size": "$$rest"}, 1}},
+				bson.M{"$arrayElemAt": bson.A{"$$rest", 0}},
+				"$$rest",
+			}},
+		}}}}},
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// restoreUnit reads the URIs and refScores of a skipped unit back from its documents.
+// Under the merge policy, the documents it shares with the earlier units get the taxa of all of them.
+func restoreUnit(ctx context.Context, db *mongo.Database, graph string, taxon string, refScores map[string]int) error {
+	if taxon == "" {
+		return nil
+	}
+	cursor, err := db.Collection(graph).Find(ctx, unitFilter(taxon),
+		options.Find().SetProjection(bson.M{"_id": 0, "uri": 1, "refScore": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	uris := []string{}
+	for cursor.Next(ctx) {
+		var doc struct {
+			URI      string      `bson:"uri"`
+			RefScore interface{} `bson:"refScore"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		uris = append(uris, doc.URI)
+		if collectionKinds[graph] == "entity" {
+			refScores[doc.URI] = int(numberValue(doc.RefScore))
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	found, err := duplicateTaxa(graph, taxon, uris)
+	if err != nil {
+		return err
+	}
+	if manifest.MergePolicy != "merge" {
+		return nil
+	}
+	// An earlier unit loaded again wrote these documents with its own taxon only.
+	for uri, taxa := range found {
+		set := bson.M{"$set": bson.M{"taxon": taxonField(taxon, taxa)}}
+		if _, err := db.Collection(graph).UpdateOne(ctx, bson.M{"uri": uri}, set); err != nil {
+			return err
+		}
+		if _, err := db.Collection(xrefCollection).UpdateMany(ctx, bson.M{"uri": uri, "collection": graph}, set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unitURIs returns the URIs of the documents of a collection matching filter.
+func unitURIs(ctx context.Context, collection *mongo.Collection, filter bson.M) ([]string, error) {
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 0, "uri": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	uris := []string{}
+	for cursor.Next(ctx) {
+		var doc struct {
+			URI string `bson:"uri"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		uris = append(uris, doc.URI)
+	}
+	return uris, cursor.Err()
+}
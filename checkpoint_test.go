@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestUnitDigestManifest(t *testing.T) {
+	saved := manifest
+	defer func() { manifest = saved }()
+	inputs := []InputFile{{Path: "uploads/prot/9606.nt.gz", Collection: "prot", SHA256: "abc"}}
+	dependencies := []InputFile{}
+
+	manifest = defaultManifest()
+	digest := unitDigest(inputs, dependencies)
+
+	tests := []struct {
+		name    string
+		change  func(m *Manifest)
+		changes bool
+	}{
+		{"ranking weight", func(m *Manifest) {
+			m.Ranking = map[string][]RankComponent{"prot": {{Scorer: "refScore", Normalize: "log", Weight: 2}}}
+		}, false},
+		{"taxa", func(m *Manifest) { m.Taxa = append(m.Taxa, "7227") }, false},
+		{"validation threshold", func(m *Manifest) { m.ValidationThresholds = map[string]float64{"missingLabel": 0.5} }, false},
+		{"text indexes", func(m *Manifest) { m.TextIndexes = map[string]TextIndexConfig{} }, false},
+		{"languages", func(m *Manifest) { m.Languages = []string{"fr"} }, true},
+		{"merge policy", func(m *Manifest) { m.MergePolicy = "merge" }, true},
+		{"literal fields", func(m *Manifest) { m.LiteralFields = map[string]string{"http://ex.org/p": "p"} }, true},
+		{"prefixes", func(m *Manifest) { m.Prefixes = map[string]string{"ex": "http://ex.org/"} }, true},
+		{"autocomplete", func(m *Manifest) { m.Autocomplete.MaxLength++ }, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manifest = defaultManifest()
+			test.change(&manifest)
+			if changed := unitDigest(inputs, dependencies) != digest; changed != test.changes {
+				t.Errorf("digest changed: %v, want %v", changed, test.changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+)
+
+// compactIRI returns the CURIE of an IRI, using the manifest prefix whose namespace is the longest match,
+// and the local ID, the part of the IRI after the namespace.
+func (m Manifest) compactIRI(iri string) (curie string, localID string, ok bool) {
+	prefix := ""
+	namespace := ""
+	for p, ns := range m.Prefixes {
+		if strings.HasPrefix(iri, ns) && len(ns) > len(namespace) {
+			prefix = p
+			namespace = ns
+		}
+	}
+	if namespace == "" || len(iri) == len(namespace) {
+		return "", "", false
+	}
+	localID = iri[len(namespace):]
+	return prefix + ":" + localID, localID, true
+}
+
+// expandCURIE returns the IRI of a CURIE with a prefix from the manifest. Other values are returned unchanged,
+// so settings can be given as IRIs or as CURIEs.
+func (m Manifest) expandCURIE(value string) string {
+	prefix, localID, ok := strings.Cut(value, ":")
+	if !ok || strings.HasPrefix(localID, "//") {
+		return value
+	}
+	if namespace, ok := m.Prefixes[prefix]; ok {
+		return namespace + localID
+	}
+	return value
+}
+
+// expandKeys returns the map with the CURIE keys expanded to IRIs.
+func (m Manifest) expandKeys(values map[string]string) map[string]string {
+	expanded := make(map[string]string, len(values))
+	for key, value := range values {
+		expanded[m.expandCURIE(key)] = value
+	}
+	return expanded
+}
+
+// setCURIE adds curie and localId to a document, if the URI is in a namespace of the prefix map.
+func setCURIE(doc map[string]interface{}, uri string) {
+	if curie, localID, ok := manifest.compactIRI(uri); ok {
+		doc["curie"] = curie
+		doc["localId"] = localID
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// buildSource is a build to compare, a Mongo database or a folder of JSONL exports.
+type buildSource interface {
+	collections(ctx context.Context) ([]string, error)
+	// scan calls read with every document of a collection.
+	scan(ctx context.Context, collection string, read func(doc diffDocument)) error
+	close(ctx context.Context)
+}
+
+// diffDocument holds the fields of a document that are compared.
+type diffDocument struct {
+	URI       string      `bson:"uri"`
+	PrefLabel string      `bson:"prefLabel"`
+	Taxon     interface{} `bson:"taxon"`
+}
+
+// openBuildSource opens a mongodb:// URI, with the database in its path (metadb by default), or a folder
+// with one <collection>.jsonl file per collection, as written by mongoexport.
+func openBuildSource(ctx context.Context, location string) (buildSource, error) {
+	if strings.HasPrefix(location, "mongodb://") || strings.HasPrefix(location, "mongodb+srv://") {
+		parsed, err := connstring.ParseAndValidate(location)
+		if err != nil {
+			return nil, err
+		}
+		database := parsed.Database
+		if database == "" {
+			database = "metadb"
+		}
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(location))
+		if err != nil {
+			return nil, err
+		}
+		return mongoSource{client: client, db: client.Database(database)}, nil
+	}
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a mongodb:// URI or a folder of JSONL exports", location)
+	}
+	return jsonlSource{path: location}, nil
+}
+
+// isDataCollection is true for the collections holding the loaded data, and false for those holding
+// metadata about the build, like _stats, or system collections.
+func isDataCollection(name string) bool {
+	return !strings.HasPrefix(name, "_") && !strings.HasPrefix(name, "system.")
+}
+
+type mongoSource struct {
+	client *mongo.Client
+	db     *mongo.Database
+}
+
+func (s mongoSource) collections(ctx context.Context) ([]string, error) {
+	names, err := s.db.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	collections := []string{}
+	for _, name := range names {
+		if isDataCollection(name) {
+			collections = append(collections, name)
+		}
+	}
+	return collections, nil
+}
+
+func (s mongoSource) scan(ctx context.Context, collection string, read func(doc diffDocument)) error {
+	cursor, err := s.db.Collection(collection).Find(ctx, bson.M{},
+		options.Find().SetProjection(bson.M{"_id": 0, "uri": 1, "prefLabel": 1, "taxon": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc diffDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		read(doc)
+	}
+	return cursor.Err()
+}
+
+func (s mongoSource) close(ctx context.Context) {
+	if err := s.client.Disconnect(ctx); err != nil {
+		panic(err)
+	}
+}
+
+type jsonlSource struct {
+	path string
+}
+
+func (s jsonlSource) collections(ctx context.Context) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.path, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	collections := []string{}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".jsonl")
+		if isDataCollection(name) {
+			collections = append(collections, name)
+		}
+	}
+	return collections, nil
+}
+
+func (s jsonlSource) scan(ctx context.Context, collection string, read func(doc diffDocument)) error {
+	file, err := os.Open(filepath.Join(s.path, collection+".jsonl"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	lines := bufio.NewScanner(file)
+	lines.Buffer(make([]byte, 64*1024), maxLineSize)
+	lineNumber := 0
+	for lines.Scan() {
+		lineNumber++
+		if strings.TrimSpace(lines.Text()) == "" {
+			continue
+		}
+		var doc diffDocument
+		if err := bson.UnmarshalExtJSON(lines.Bytes(), false, &doc); err != nil {
+			return fmt.Errorf("%s.jsonl line %d: %w", collection, lineNumber, err)
+		}
+		read(doc)
+	}
+	return lines.Err()
+}
+
+func (s jsonlSource) close(ctx context.Context) {}
+
+// BuildDiff is the difference between two builds, per collection.
+type BuildDiff struct {
+	Old         string           `json:"old"`
+	New         string           `json:"new"`
+	Collections []CollectionDiff `json:"collections"`
+}
+
+type CollectionDiff struct {
+	Collection string `json:"collection"`
+	// Status is "added" or "removed" for collections in only one of the builds.
+	Status            string        `json:"status,omitempty"`
+	Old               int           `json:"old"`
+	New               int           `json:"new"`
+	Added             int           `json:"added"`
+	Removed           int           `json:"removed"`
+	Relabeled         int           `json:"relabeled"`
+	AddedExamples     []string      `json:"addedExamples"`
+	RemovedExamples   []string      `json:"removedExamples"`
+	RelabeledExamples []LabelChange `json:"relabeledExamples"`
+	Swings            []CountSwing  `json:"swings"`
+}
+
+type LabelChange struct {
+	URI string `json:"uri"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// CountSwing is a change in the number of documents of a taxon, or of the whole collection when Taxon is "".
+// Change is relative to the old count, and 1 for counts that were 0.
+type CountSwing struct {
+	Taxon  string  `json:"taxon,omitempty"`
+	Old    int     `json:"old"`
+	New    int     `json:"new"`
+	Change float64 `json:"change"`
+}
+
+// diffOptions are the flags of the diff command.
+type diffOptions struct {
+	// swing is the relative change in a count that is reported.
+	swing    float64
+	examples int
+}
+
+// runDiff runs the diff command: metadb-go diff [flags] <old build> <new build>.
+func runDiff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	var opts diffOptions
+	var reportPath string
+	flags.Float64Var(&opts.swing, "swing", 0.1, "smallest relative change in a document count that is reported")
+	flags.IntVar(&opts.examples, "examples", 10, "number of example URIs listed per change")
+	flags.StringVar(&reportPath, "o", "", "path of the JSON diff report")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: metadb-go diff [flags] <old build> <new build>")
+		fmt.Fprintln(flags.Output(), "A build is a mongodb:// URI with the database in its path, or a folder of mongoexport JSONL files named by collection.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := rootContext()
+	defer stop()
+	defer func() {
+		if r := recover(); r != nil {
+			if ctx.Err() == nil {
+				panic(r)
+			}
+			slog.Error("Diff interrupted")
+			os.Exit(exitInterrupted)
+		}
+	}()
+
+	oldBuild, err := openBuildSource(ctx, flags.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	defer oldBuild.close(ctx)
+	newBuild, err := openBuildSource(ctx, flags.Arg(1))
+	if err != nil {
+		panic(err)
+	}
+	defer newBuild.close(ctx)
+
+	diff, err := diffBuilds(ctx, oldBuild, newBuild, opts)
+	if err != nil {
+		panic(err)
+	}
+	diff.Old = flags.Arg(0)
+	diff.New = flags.Arg(1)
+
+	if reportPath != "" {
+		content, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		if err := os.WriteFile(reportPath, content, 0644); err != nil {
+			slog.Error("Error writing diff report", "file", reportPath, "err", err)
+		}
+	}
+	printBuildDiff(diff)
+}
+
+func diffBuilds(ctx context.Context, oldBuild buildSource, newBuild buildSource, opts diffOptions) (BuildDiff, error) {
+	oldCollections, err := oldBuild.collections(ctx)
+	if err != nil {
+		return BuildDiff{}, err
+	}
+	newCollections, err := newBuild.collections(ctx)
+	if err != nil {
+		return BuildDiff{}, err
+	}
+	inOld := make(map[string]bool)
+	for _, name := range oldCollections {
+		inOld[name] = true
+	}
+	inNew := make(map[string]bool)
+	for _, name := range newCollections {
+		inNew[name] = true
+	}
+	names := append([]string{}, oldCollections...)
+	for _, name := range newCollections {
+		if !inOld[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diff := BuildDiff{Collections: []CollectionDiff{}}
+	for _, name := range names {
+		var oldSource, newSource buildSource
+		if inOld[name] {
+			oldSource = oldBuild
+		}
+		if inNew[name] {
+			newSource = newBuild
+		}
+		collectionDiff, err := diffCollection(ctx, name, oldSource, newSource, opts)
+		if err != nil {
+			return diff, fmt.Errorf("[%s] %w", name, err)
+		}
+		diff.Collections = append(diff.Collections, collectionDiff)
+	}
+	return diff, nil
+}
+
+// diffCollection compares a collection of two builds. A nil source is a build without the collection.
+// The old documents are kept in memory, by URI, while the new ones are read.
+func diffCollection(ctx context.Context, name string, oldSource buildSource, newSource buildSource, opts diffOptions) (CollectionDiff, error) {
+	diff := CollectionDiff{
+		Collection:        name,
+		AddedExamples:     []string{},
+		RemovedExamples:   []string{},
+		RelabeledExamples: []LabelChange{},
+		Swings:            []CountSwing{},
+	}
+	if oldSource == nil {
+		diff.Status = "added"
+	} else if newSource == nil {
+		diff.Status = "removed"
+	}
+
+	oldLabels := make(map[string]string)
+	oldCounts := make(map[string]int)
+	if oldSource != nil {
+		err := oldSource.scan(ctx, name, func(doc diffDocument) {
+			diff.Old++
+			oldCounts[strings.TrimPrefix(firstTaxon(doc.Taxon), taxonPrefix)]++
+			oldLabels[doc.URI] = doc.PrefLabel
+		})
+		if err != nil {
+			return diff, err
+		}
+	}
+
+	newCounts := make(map[string]int)
+	seen := make(map[string]bool)
+	if newSource != nil {
+		err := newSource.scan(ctx, name, func(doc diffDocument) {
+			diff.New++
+			newCounts[strings.TrimPrefix(firstTaxon(doc.Taxon), taxonPrefix)]++
+			// Collections like xref have several documents per URI.
+			if seen[doc.URI] {
+				return
+			}
+			seen[doc.URI] = true
+			oldLabel, ok := oldLabels[doc.URI]
+			if !ok {
+				diff.Added++
+				if len(diff.AddedExamples) < opts.examples {
+					diff.AddedExamples = append(diff.AddedExamples, doc.URI)
+				}
+				return
+			}
+			if oldLabel != doc.PrefLabel {
+				diff.Relabeled++
+				if len(diff.RelabeledExamples) < opts.examples {
+					diff.RelabeledExamples = append(diff.RelabeledExamples, LabelChange{URI: doc.URI, Old: oldLabel, New: doc.PrefLabel})
+				}
+			}
+		})
+		if err != nil {
+			return diff, err
+		}
+	}
+
+	removed := []string{}
+	for uri := range oldLabels {
+		if !seen[uri] {
+			removed = append(removed, uri)
+		}
+	}
+	sort.Strings(removed)
+	diff.Removed = len(removed)
+	if len(removed) > opts.examples {
+		removed = removed[:opts.examples]
+	}
+	diff.RemovedExamples = removed
+
+	if swing, ok := countSwing("", diff.Old, diff.New, opts.swing); ok {
+		diff.Swings = append(diff.Swings, swing)
+	}
+	taxa := []string{}
+	for taxon := range oldCounts {
+		taxa = append(taxa, taxon)
+	}
+	for taxon := range newCounts {
+		if _, ok := oldCounts[taxon]; !ok {
+			taxa = append(taxa, taxon)
+		}
+	}
+	sort.Strings(taxa)
+	for _, taxon := range taxa {
+		if taxon == "" {
+			continue
+		}
+		if swing, ok := countSwing(taxon, oldCounts[taxon], newCounts[taxon], opts.swing); ok {
+			diff.Swings = append(diff.Swings, swing)
+		}
+	}
+	return diff, nil
+}
+
+// countSwing returns the change between two counts, and whether it is larger than threshold.
+func countSwing(taxon string, oldCount int, newCount int, threshold float64) (CountSwing, bool) {
+	swing := CountSwing{Taxon: taxon, Old: oldCount, New: newCount}
+	if oldCount == newCount {
+		return swing, false
+	}
+	if oldCount == 0 {
+		swing.Change = 1
+	} else {
+		swing.Change = float64(newCount-oldCount) / float64(oldCount)
+	}
+	return swing, swing.Change > threshold || swing.Change < -threshold
+}
+
+func printBuildDiff(diff BuildDiff) {
+	fmt.Printf("Diff of %s and %s:\n", diff.Old, diff.New)
+	for _, c := range diff.Collections {
+		status := ""
+		if c.Status != "" {
+			status = " " + c.Status
+		}
+		fmt.Printf("  [%s]%s %d -> %d documents, %d added, %d removed, %d relabeled\n",
+			c.Collection, status, c.Old, c.New, c.Added, c.Removed, c.Relabeled)
+		for _, swing := range c.Swings {
+			location := "all taxa"
+			if swing.Taxon != "" {
+				location = "taxon " + swing.Taxon
+			}
+			fmt.Printf("      Count swing in %s: %d -> %d (%+.1f%%)\n", location, swing.Old, swing.New, swing.Change*100)
+		}
+		for _, uri := range c.AddedExamples {
+			fmt.Println("      +", uri)
+		}
+		for _, uri := range c.RemovedExamples {
+			fmt.Println("      -", uri)
+		}
+		for _, change := range c.RelabeledExamples {
+			fmt.Printf("      ~ %s: %q -> %q\n", change.URI, change.Old, change.New)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// discoverTaxa builds the taxa found in the uploads folder, instead of the manifest's taxa.
+var discoverTaxa = false
+
+// taxonGraphs are the graph folders with files named by taxon, like prot/9606.nt.gz or prot2prot/intact_9606.nt.gz.
+var taxonGraphs = []string{"prot", "gene", "prot2bp", "prot2cc", "prot2mf", "prot2prot", "gene2phen"}
+
+// graphTaxa limits the taxa a graph is expected to have files for. We only have diseases for humans.
+var graphTaxa = map[string][]string{
+	"gene2phen": {"9606"},
+}
+
+// inputFolders are the other folders read by the builder, with the files they are expected to have.
+var inputFolders = map[string][]string{
+	"onto":     {"go-basic", "omim"},
+	"taxonomy": {},
+}
+
+// Discovery is what was found in the uploads folder.
+type Discovery struct {
+	// files holds the RDF files found per graph and taxon.
+	files map[string]map[string][]string
+	// unknownFolders are folders that are not read by the builder.
+	unknownFolders []string
+	// unrecognized are files in graph folders that are not RDF files named by taxon.
+	unrecognized []string
+}
+
+// taxa returns the taxa with files in any graph, sorted.
+func (d Discovery) taxa() []string {
+	found := make(map[string]bool)
+	for _, byTaxon := range d.files {
+		for taxon := range byTaxon {
+			found[taxon] = true
+		}
+	}
+	taxa := make([]string, 0, len(found))
+	for taxon := range found {
+		taxa = append(taxa, taxon)
+	}
+	sort.Slice(taxa, func(i, j int) bool {
+		if len(taxa[i]) != len(taxa[j]) {
+			return len(taxa[i]) < len(taxa[j])
+		}
+		return taxa[i] < taxa[j]
+	})
+	return taxa
+}
+
+// discoverInputs scans the graph folders in rdfPath, and infers the taxon of every RDF file from the digits its name ends with.
+func discoverInputs(rdfPath string) (Discovery, error) {
+	discovery := Discovery{files: make(map[string]map[string][]string)}
+	entries, err := os.ReadDir(rdfPath)
+	if err != nil {
+		return discovery, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		graph := entry.Name()
+		if _, ok := inputFolders[graph]; ok {
+			continue
+		}
+		if !isTaxonGraph(graph) {
+			discovery.unknownFolders = append(discovery.unknownFolders, graph)
+			continue
+		}
+		files, err := os.ReadDir(rdfPath + "/" + graph)
+		if err != nil {
+			return discovery, err
+		}
+		for _, file := range files {
+			if file.IsDir() || strings.HasSuffix(file.Name(), ".graph") {
+				continue
+			}
+			base, _, _, ok := splitRDFExtension(file.Name())
+			taxon := trailingDigits(base)
+			if !ok || taxon == "" {
+				discovery.unrecognized = append(discovery.unrecognized, graph+"/"+file.Name())
+				continue
+			}
+			if discovery.files[graph] == nil {
+				discovery.files[graph] = make(map[string][]string)
+			}
+			discovery.files[graph][taxon] = append(discovery.files[graph][taxon], file.Name())
+		}
+	}
+	return discovery, nil
+}
+
+func isTaxonGraph(graph string) bool {
+	for _, g := range taxonGraphs {
+		if g == graph {
+			return true
+		}
+	}
+	return false
+}
+
+func trailingDigits(value string) string {
+	start := len(value)
+	for start > 0 && value[start-1] >= '0' && value[start-1] <= '9' {
+		start--
+	}
+	return value[start:]
+}
+
+// checkInputs compares the discovered files with the taxa to build, and prints a warning for every missing file,
+// for taxa with files that are not built, and for unknown folders and files. It returns the number of warnings.
+func checkInputs(rdfPath string, discovery Discovery, taxa []string) int {
+	warnings := 0
+	warn := func(message string, args ...any) {
+		slog.Warn(message, append([]any{"phase", "discover"}, args...)...)
+		warnings++
+	}
+
+	building := make(map[string]bool)
+	for _, taxon := range taxa {
+		building[taxon] = true
+	}
+	for _, graph := range taxonGraphs {
+		expected := taxa
+		if limited, ok := graphTaxa[graph]; ok {
+			expected = limited
+		}
+		for _, taxon := range expected {
+			if building[taxon] && len(discovery.files[graph][taxon]) == 0 {
+				warn("No input file", "graph", graph, "taxon", taxon)
+			}
+		}
+		for _, taxon := range discovery.taxa() {
+			if ambiguous := ambiguousFiles(discovery.files[graph][taxon]); len(ambiguous) > 0 {
+				warn("Several input files with the same name, the graph is not loaded", "graph", graph, "taxon", taxon,
+					"files", strings.Join(ambiguous, ","))
+			}
+		}
+	}
+	for _, taxon := range discovery.taxa() {
+		if building[taxon] {
+			continue
+		}
+		graphs := []string{}
+		for _, graph := range taxonGraphs {
+			if len(discovery.files[graph][taxon]) > 0 {
+				graphs = append(graphs, graph)
+			}
+		}
+		warn("Taxon with input files is not in the manifest's taxa", "taxon", taxon, "graphs", strings.Join(graphs, ","))
+	}
+
+	folders := make([]string, 0, len(inputFolders))
+	for folder := range inputFolders {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+	for _, folder := range folders {
+		for _, name := range inputFolders[folder] {
+			if _, err := findRDFFile(rdfPath+"/"+folder, name); err != nil {
+				warn("Missing or ambiguous input file", "graph", folder, "file", name, "err", err)
+			}
+		}
+	}
+	for _, folder := range discovery.unknownFolders {
+		warn("Folder is not read by the builder", "file", folder)
+	}
+	for _, file := range discovery.unrecognized {
+		warn("Not an RDF file named by taxon", "file", file)
+	}
+	return warnings
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// mergePolicies are the values of the manifest's mergePolicy, for URIs found in more than one taxon file:
+// "first" keeps the document from the first taxon, "merge" keeps the last document with the taxa of all files
+// in its taxon array, and "error" stops the build. The merge policy only merges the taxa: the labels, synonyms
+// and other fields of the last file replace those of the earlier ones.
+var mergePolicies = []string{"first", "merge", "error"}
+
+// errDuplicateURIs is returned by duplicateTaxa with the error merge policy.
+var errDuplicateURIs = errors.New("URIs were already loaded from another taxon")
+
+// duplicateExamples is how many duplicated URIs are printed per collection in the summary.
+var duplicateExamples = 10
+
+var loadedTaxa = struct {
+	sync.Mutex
+	// taxa holds the taxa each URI was loaded from, in load order, per collection.
+	taxa map[string]map[string][]string
+	// duplicates holds the URIs loaded from more than one taxon, per collection.
+	duplicates map[string][]string
+}{taxa: make(map[string]map[string][]string), duplicates: make(map[string][]string)}
+
+// duplicateTaxa records the URIs loaded into a collection from a taxon file, and returns the URIs that were
+// already loaded from another taxon, with all their taxa. With the error merge policy, they are an error instead.
+func duplicateTaxa(collection string, taxon string, uris []string) (map[string][]string, error) {
+	loadedTaxa.Lock()
+	defer loadedTaxa.Unlock()
+	if loadedTaxa.taxa[collection] == nil {
+		loadedTaxa.taxa[collection] = make(map[string][]string)
+	}
+	seen := loadedTaxa.taxa[collection]
+
+	found := make(map[string][]string)
+	for _, uri := range uris {
+		taxa := seen[uri]
+		if len(taxa) == 0 {
+			seen[uri] = []string{taxon}
+			continue
+		}
+		if taxa[len(taxa)-1] == taxon {
+			continue
+		}
+		if len(taxa) == 1 {
+			loadedTaxa.duplicates[collection] = append(loadedTaxa.duplicates[collection], uri)
+		}
+		taxa = append(taxa, taxon)
+		seen[uri] = taxa
+		found[uri] = taxa
+	}
+	if len(found) == 0 {
+		return found, nil
+	}
+
+	slog.Warn("URIs were already loaded from another taxon", "phase", "parse", "graph", collection, "taxon", taxon,
+		"count", len(found), "mergePolicy", manifest.MergePolicy)
+	if manifest.MergePolicy == "error" {
+		examples := []string{}
+		for uri, taxa := range found {
+			if len(examples) == duplicateExamples {
+				break
+			}
+			examples = append(examples, uri+" in taxa "+strings.Join(taxa, ","))
+		}
+		slog.Error("Duplicate URIs with the error merge policy", "graph", collection, "taxon", taxon, "examples", examples)
+		return nil, fmt.Errorf("[%s][%s] %d %w", taxon, collection, len(found), errDuplicateURIs)
+	}
+	return found, nil
+}
+
+// taxonField is the taxon of a document, or the taxa of a URI that was merged from several taxon files.
+func taxonField(taxon string, taxa []string) interface{} {
+	if len(taxa) < 2 {
+		return taxonPrefix + taxon
+	}
+	values := []string{}
+	for _, t := range taxa {
+		values = append(values, taxonPrefix+t)
+	}
+	return values
+}
+
+// printDuplicateSummary prints how many URIs were loaded from more than one taxon per collection, with examples.
+func printDuplicateSummary() {
+	loadedTaxa.Lock()
+	defer loadedTaxa.Unlock()
+	collections := make([]string, 0, len(loadedTaxa.duplicates))
+	for collection := range loadedTaxa.duplicates {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+	for _, collection := range collections {
+		uris := loadedTaxa.duplicates[collection]
+		examples := []string{}
+		for i, uri := range uris {
+			if i == duplicateExamples {
+				break
+			}
+			examples = append(examples, uri+" in taxa "+strings.Join(loadedTaxa.taxa[collection][uri], ","))
+		}
+		slog.Warn("Duplicate URIs", "graph", collection, "count", len(uris), "examples", examples)
+	}
+}
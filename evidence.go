@@ -0,0 +1,30 @@
+package main
+
+import (
+	"math"
+)
+
+// evidenceSources returns the distinct source databases of the evidence origins: the prefix of the origin in the
+// manifest's prefix map (e.g. intact), or else its namespace IRI.
+func evidenceSources(instances []string) []string {
+	sources := []string{}
+	seen := make(map[string]bool)
+	for _, instance := range instances {
+		source, _ := splitXref(instance)
+		if source != "" && !seen[source] {
+			sources = append(sources, source)
+			seen[source] = true
+		}
+	}
+	return sources
+}
+
+// maxEvidenceLevel returns the highest evidence level of a statement, which is the one used for filtering
+// when several sources give one.
+func maxEvidenceLevel(levels []float64) float64 {
+	level := math.Inf(-1)
+	for _, l := range levels {
+		level = math.Max(level, l)
+	}
+	return level
+}
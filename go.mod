@@ -1,15 +1,16 @@
 module metadb-go
 
-go 1.19
+go 1.21
 
 require (
-	github.com/shful/gofp v0.0.1
+	github.com/klauspost/compress v1.13.6
+	github.com/ulikunitz/xz v0.5.15
 	go.mongodb.org/mongo-driver v1.10.2
+	golang.org/x/text v0.3.7
 )
 
 require (
 	github.com/golang/snappy v0.0.1 // indirect
-	github.com/klauspost/compress v1.13.6 // indirect
 	github.com/montanaflynn/stats v0.0.0-20171201202039-1bf9dbcd8cbe // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
@@ -18,5 +19,4 @@ require (
 	github.com/youmark/pkcs8 v0.0.0-20181117223130-1be2e3e5546d // indirect
 	golang.org/x/crypto v0.0.0-20220622213112-05595931fe9d // indirect
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
-	golang.org/x/text v0.3.7 // indirect
 )
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// copyBatchSize is the number of documents written per bulk write, when copying from the previous build and when
+// updating the documents of a collection.
+var copyBatchSize = 1000
+
+// PreviousBuild is the MetaDB of an earlier version, given with -previous. The units it loaded from the same
+// inputs as this build are copied from it instead of parsed.
+type PreviousBuild struct {
+	client *mongo.Client
+	db     *mongo.Database
+	// units are the checkpoints in its provenance record, by graph and taxon.
+	units   map[string]Checkpoint
+	version string
+}
+
+var previousBuild *PreviousBuild
+
+func unitKey(graph string, taxon string) string {
+	return graph + "/" + taxon
+}
+
+// openPreviousBuild connects to the MetaDB at a mongodb:// URI, with the database in its path (metadb by default),
+// and reads its provenance record.
+func openPreviousBuild(ctx context.Context, uri string) (*PreviousBuild, error) {
+	parsed, err := connstring.ParseAndValidate(uri)
+	if err != nil {
+		return nil, err
+	}
+	database := parsed.Database
+	if database == "" {
+		database = "metadb"
+	}
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	previous := &PreviousBuild{client: client, db: client.Database(database), units: make(map[string]Checkpoint)}
+	var record struct {
+		Version string       `bson:"version"`
+		Status  string       `bson:"status"`
+		Units   []Checkpoint `bson:"units"`
+	}
+	err = previous.db.Collection(buildCollection).FindOne(ctx, bson.M{"_id": "build"}).Decode(&record)
+	if err != nil {
+		disconnect(client)
+		return nil, fmt.Errorf("no provenance record in %s: %w", buildCollection, err)
+	}
+	if record.Status != "completed" {
+		slog.Warn("The previous build is not completed", "phase", "incremental", "version", record.Version, "status", record.Status)
+	}
+	for _, unit := range record.Units {
+		previous.units[unitKey(unit.Graph, unit.Taxon)] = unit
+	}
+	previous.version = record.Version
+	slog.Info("Read the previous build", "phase", "incremental", "version", record.Version, "count", len(record.Units))
+	return previous, nil
+}
+
+func (p *PreviousBuild) close() {
+	if err := disconnect(p.client); err != nil {
+		panic(err)
+	}
+}
+
+// copyUnit copies the documents, cross-references and citations of a unit from the previous build, with the same
+// filter as restoreUnit and clearUnit.
+func (p *PreviousBuild) copyUnit(ctx context.Context, db *mongo.Database, graph string, taxon string) error {
+	filter := unitFilter(taxon)
+	copied, err := copyDocuments(ctx, p.db.Collection(graph), db.Collection(graph), filter, []string{"uri"})
+	if err != nil {
+		return err
+	}
+	xrefFilter := unitFilter(taxon)
+	xrefFilter["collection"] = graph
+	if _, err := copyDocuments(ctx, p.db.Collection(xrefCollection), db.Collection(xrefCollection), xrefFilter, []string{"xref", "uri"}); err != nil {
+		return err
+	}
+	slog.Info("Copied documents from the previous build", "phase", "incremental", "graph", graph, "taxon", taxon, "count", copied, "version", p.version)
+
+	field := "statements"
+	switch collectionKinds[graph] {
+	case "entity":
+		field = "entities"
+	case "ontology":
+		return nil
+	}
+	uris, err := unitURIs(ctx, p.db.Collection(graph), filter)
+	if err != nil {
+		return err
+	}
+	publications, err := p.copyCitations(ctx, db, field, uris)
+	if err != nil {
+		return err
+	}
+	slog.Info("Copied citations from the previous build", "phase", "incremental", "graph", graph, "taxon", taxon, "count", publications, "version", p.version)
+	return nil
+}
+
+// copyCitations adds the documents of a copied unit to the publications citing them in the previous build.
+// Only these citations are copied, the publications of the parsed units get theirs from the parser.
+func (p *PreviousBuild) copyCitations(ctx context.Context, db *mongo.Database, field string, uris []string) (int, error) {
+	from, to := p.db.Collection(publicationCollection), db.Collection(publicationCollection)
+	copied := 0
+	for start := 0; start < len(uris); start += copyBatchSize {
+		end := start + copyBatchSize
+		if end > len(uris) {
+			end = len(uris)
+		}
+		batch := uris[start:end]
+		inBatch := make(map[string]bool, len(batch))
+		for _, uri := range batch {
+			inBatch[uri] = true
+		}
+		cursor, err := from.Find(ctx, bson.M{field: bson.M{"$in": batch}},
+			options.Find().SetProjection(bson.M{"_id": 0, "entityCount": 0, "statementCount": 0}))
+		if err != nil {
+			return copied, err
+		}
+		models := []mongo.WriteModel{}
+		for cursor.Next(ctx) {
+			var doc bson.M
+			if err := cursor.Decode(&doc); err != nil {
+				cursor.Close(ctx)
+				return copied, err
+			}
+			cited := bson.A{}
+			if values, ok := doc[field].(bson.A); ok {
+				for _, value := range values {
+					if uri, ok := value.(string); ok && inBatch[uri] {
+						cited = append(cited, uri)
+					}
+				}
+			}
+			delete(doc, "entities")
+			delete(doc, "statements")
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"pmid": doc["pmid"]}).
+				SetUpdate(bson.M{"$set": doc, "$addToSet": bson.M{field: bson.M{"$each": cited}}}).
+				SetUpsert(true))
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return copied, err
+		}
+		if len(models) > 0 {
+			if _, err := to.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+				return copied, err
+			}
+		}
+		copied += len(models)
+	}
+	return copied, nil
+}
+
+// copyDocuments upserts the documents of one collection matching filter into another, by the key fields.
+// The _id is left out, the documents may already be in the target with another one.
+func copyDocuments(ctx context.Context, from *mongo.Collection, to *mongo.Collection, filter bson.M, key []string) (int, error) {
+	cursor, err := from.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 0}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+	copied := 0
+	batch := []mongo.WriteModel{}
+	write := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := to.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		copied += len(batch)
+		batch = batch[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return copied, err
+		}
+		keyFilter := bson.M{}
+		for _, field := range key {
+			keyFilter[field] = doc[field]
+		}
+		batch = append(batch, mongo.NewReplaceOneModel().SetFilter(keyFilter).SetReplacement(doc).SetUpsert(true))
+		if len(batch) == copyBatchSize {
+			if err := write(); err != nil {
+				return copied, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return copied, err
+	}
+	return copied, write()
+}
+
+// incrementalSummary prints which units were copied from the previous build and which were parsed.
+func incrementalSummary() {
+	if previousBuild == nil {
+		return
+	}
+	slog.Info("Copied units from the previous build", "phase", "incremental", "version", previousBuild.version,
+		"count", len(copiedUnits), "units", strings.Join(copiedUnits, ","))
+	slog.Info("Parsed units", "phase", "incremental", "count", len(parsedUnits), "units", strings.Join(parsedUnits, ","))
+}
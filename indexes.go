@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// caseInsensitive is the collation of the case-insensitive label indexes.
+// Queries must use the same collation to use them.
+var caseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
+// indexAfterLoad creates the indexes after all the data is loaded instead of before, which makes the bulk load faster.
+var indexAfterLoad = false
+
+// collectionKinds maps the collections to the kind of documents they hold.
+// Collections that are not listed hold statements.
+var collectionKinds = map[string]string{
+	"prot":        "entity",
+	"gene":        "entity",
+	"goall":       "ontology",
+	"omim":        "ontology",
+	"xref":        "xref",
+	"taxon":       "taxon",
+	"publication": "publication",
+}
+
+// indexSpecs declares the indexes of each kind of collection, and the extra indexes of single collections.
+// The index used by the upserts must come first, see prepareCollection. The text index is configured in the manifest, see ensureTextIndex.
+var indexSpecs = map[string][]mongo.IndexModel{
+	"entity": {
+		{Keys: ascending("uri"), Options: options.Index().SetName("uri_unique").SetUnique(true)},
+		{Keys: ascending("lcLabel"), Options: options.Index().SetName("lcLabel_1")},
+		{Keys: ascending("normLabel"), Options: options.Index().SetName("normLabel_1")},
+		{Keys: ascending("curie"), Options: options.Index().SetName("curie_1")},
+		{Keys: ascending("prefLabel"), Options: options.Index().SetName("prefLabel_ci").SetCollation(caseInsensitive)},
+		{Keys: ascending("lcSynonyms"), Options: options.Index().SetName("lcSynonyms_1")},
+		{Keys: ascending("normSynonyms"), Options: options.Index().SetName("normSynonyms_1")},
+		{Keys: ascending("synonyms"), Options: options.Index().SetName("synonyms_ci").SetCollation(caseInsensitive)},
+		{Keys: ascending("tokens"), Options: options.Index().SetName("tokens_1")},
+		{Keys: ascending("prefixes"), Options: options.Index().SetName("prefixes_1")},
+		{Keys: ascending("refScore"), Options: options.Index().SetName("refScore_1")},
+		{Keys: ascending("rank"), Options: options.Index().SetName("rank_1")},
+		{Keys: ascending("taxon", "refScore"), Options: options.Index().SetName("taxon_partial").SetPartialFilterExpression(hasTaxon)},
+		{Keys: ascending("instances"), Options: options.Index().SetName("instances_1")},
+	},
+	"ontology": {
+		{Keys: ascending("uri"), Options: options.Index().SetName("uri_unique").SetUnique(true)},
+		{Keys: ascending("lcLabel"), Options: options.Index().SetName("lcLabel_1")},
+		{Keys: ascending("normLabel"), Options: options.Index().SetName("normLabel_1")},
+		{Keys: ascending("curie"), Options: options.Index().SetName("curie_1")},
+		{Keys: ascending("prefLabel"), Options: options.Index().SetName("prefLabel_ci").SetCollation(caseInsensitive)},
+		{Keys: ascending("lcSynonyms"), Options: options.Index().SetName("lcSynonyms_1")},
+		{Keys: ascending("normSynonyms"), Options: options.Index().SetName("normSynonyms_1")},
+		{Keys: ascending("synonyms"), Options: options.Index().SetName("synonyms_ci").SetCollation(caseInsensitive)},
+		{Keys: ascending("tokens"), Options: options.Index().SetName("tokens_1")},
+		{Keys: ascending("prefixes"), Options: options.Index().SetName("prefixes_1")},
+		{Keys: ascending("refScore"), Options: options.Index().SetName("refScore_1")},
+		{Keys: ascending("rank"), Options: options.Index().SetName("rank_1")},
+		{Keys: ascending("subClassOf"), Options: options.Index().SetName("subClassOf_1")},
+	},
+	"statement": {
+		{Keys: ascending("uri"), Options: options.Index().SetName("uri_unique").SetUnique(true)},
+		{Keys: ascending("lcLabel"), Options: options.Index().SetName("lcLabel_1")},
+		{Keys: ascending("normLabel"), Options: options.Index().SetName("normLabel_1")},
+		{Keys: ascending("curie"), Options: options.Index().SetName("curie_1")},
+		{Keys: ascending("prefLabel"), Options: options.Index().SetName("prefLabel_ci").SetCollation(caseInsensitive)},
+		{Keys: ascending("subject"), Options: options.Index().SetName("subject_1")},
+		{Keys: ascending("object"), Options: options.Index().SetName("object_1")},
+		{Keys: ascending("predicate"), Options: options.Index().SetName("predicate_1")},
+		{Keys: ascending("sources"), Options: options.Index().SetName("sources_1")},
+		{Keys: ascending("evidenceLevel"), Options: options.Index().SetName("evidenceLevel_1")},
+		{Keys: ascending("taxon"), Options: options.Index().SetName("taxon_partial").SetPartialFilterExpression(hasTaxon)},
+	},
+	"xref": {
+		{Keys: ascending("xref", "uri"), Options: options.Index().SetName("xref_uri_unique").SetUnique(true)},
+		{Keys: ascending("namespace", "localId"), Options: options.Index().SetName("namespace_localId")},
+		{Keys: ascending("localId"), Options: options.Index().SetName("localId_1")},
+		{Keys: ascending("uri"), Options: options.Index().SetName("uri_1")},
+	},
+	"publication": {
+		{Keys: ascending("pmid"), Options: options.Index().SetName("pmid_unique").SetUnique(true)},
+		{Keys: ascending("uri"), Options: options.Index().SetName("uri_1")},
+		{Keys: ascending("entities"), Options: options.Index().SetName("entities_1")},
+		{Keys: ascending("statements"), Options: options.Index().SetName("statements_1")},
+	},
+	"taxon": {
+		{Keys: ascending("uri"), Options: options.Index().SetName("uri_unique").SetUnique(true)},
+		{Keys: ascending("taxonId"), Options: options.Index().SetName("taxonId_1")},
+		{Keys: ascending("lcLabel"), Options: options.Index().SetName("lcLabel_1")},
+		{Keys: ascending("normLabel"), Options: options.Index().SetName("normLabel_1")},
+		{Keys: ascending("curie"), Options: options.Index().SetName("curie_1")},
+	},
+	"gene": {
+		{Keys: ascending("encodes"), Options: options.Index().SetName("encodes_1")},
+	},
+}
+
+// hasTaxon limits the taxon indexes to the documents that have a taxon.
+var hasTaxon = bson.M{"taxon": bson.M{"$exists": true}}
+
+func ascending(fields ...string) bson.D {
+	keys := bson.D{}
+	for _, field := range fields {
+		keys = append(keys, bson.E{Key: field, Value: 1})
+	}
+	return keys
+}
+
+// collectionIndexes returns the declared indexes of a collection.
+func collectionIndexes(collection string) []mongo.IndexModel {
+	kind, ok := collectionKinds[collection]
+	if !ok {
+		kind = "statement"
+	}
+	indexes := append([]mongo.IndexModel{}, indexSpecs[kind]...)
+	if kind != collection {
+		indexes = append(indexes, indexSpecs[collection]...)
+	}
+	return indexes
+}
+
+var preparedCollections = struct {
+	sync.Mutex
+	names []string
+}{}
+
+// prepareCollection is called once per graph before its documents are inserted.
+// The indexes of a collection are created the first time it is prepared. With indexAfterLoad, only the uri index
+// (or the xref and pmid indexes of the xref and publication collections) is created, since the upserts need it, and the others are created by createDeferredIndexes at the end of the build.
+func prepareCollection(ctx context.Context, client *mongo.Client, name string) {
+	preparedCollections.Lock()
+	defer preparedCollections.Unlock()
+	for _, prepared := range preparedCollections.names {
+		if prepared == name {
+			return
+		}
+	}
+	preparedCollections.names = append(preparedCollections.names, name)
+
+	collection := client.Database("metadb").Collection(name)
+	dropStaleIndexes(ctx, collection)
+	if indexAfterLoad {
+		createIndexes(ctx, collection, collectionIndexes(name)[:1])
+		return
+	}
+	createIndexes(ctx, collection, collectionIndexes(name))
+	ensureTextIndex(ctx, collection)
+}
+
+// loadedCollections returns the collections that have been prepared so far, in load order.
+func loadedCollections() []string {
+	preparedCollections.Lock()
+	defer preparedCollections.Unlock()
+	return append([]string{}, preparedCollections.names...)
+}
+
+// createDeferredIndexes creates the indexes of all the loaded collections when indexAfterLoad is set.
+func createDeferredIndexes(ctx context.Context, client *mongo.Client) {
+	if !indexAfterLoad {
+		return
+	}
+	preparedCollections.Lock()
+	defer preparedCollections.Unlock()
+	for _, name := range preparedCollections.names {
+		slog.Info("Creating indexes", "phase", "indexes", "graph", name)
+		collection := client.Database("metadb").Collection(name)
+		createIndexes(ctx, collection, collectionIndexes(name))
+		ensureTextIndex(ctx, collection)
+	}
+}
+
+// createIndexes creates the indexes of a collection. A unique index fails on a collection with duplicate keys, e.g.
+// left by a build from before the uri indexes were unique, which can only be fixed by loading the collection again.
+func createIndexes(ctx context.Context, collection *mongo.Collection, indexes []mongo.IndexModel) {
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	if mongo.IsDuplicateKeyError(err) {
+		panic(fmt.Errorf("[%s] the collection has duplicate keys for its unique indexes, drop it (or remove db/) and build again: %w",
+			collection.Name(), err))
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// dropStaleIndexes drops the indexes of a collection that are no longer declared, such as the non-unique uri_1 of
+// older builds. The text index is left to ensureTextIndex.
+func dropStaleIndexes(ctx context.Context, collection *mongo.Collection) {
+	names := map[string]bool{"_id_": true}
+	for _, index := range collectionIndexes(collection.Name()) {
+		names[*index.Options.Name] = true
+	}
+
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		panic(err)
+	}
+	var existing []bson.M
+	if err := cursor.All(ctx, &existing); err != nil {
+		panic(err)
+	}
+	for _, index := range existing {
+		name, _ := index["name"].(string)
+		if _, isText := index["weights"]; isText || names[name] {
+			continue
+		}
+		if _, err := collection.Indexes().DropOne(ctx, name); err != nil {
+			panic(err)
+		}
+		slog.Info("Dropped index", "phase", "indexes", "graph", collection.Name(), "index", name)
+	}
+}
+
+// textIndexName is the name of the weighted text index. A collection can only have one text index,
+// so text indexes with other names (like the old definition_text) are dropped before it is created.
+var textIndexName = "searchText"
+
+// ensureTextIndex creates the weighted text index configured in the manifest for a collection.
+// An existing text index is kept if it has the same weights and default language, and replaced otherwise.
+func ensureTextIndex(ctx context.Context, collection *mongo.Collection) {
+	config := manifest.textIndexConfig(collection.Name())
+	weights := bson.M{}
+	for field, weight := range config.Weights {
+		weights[field] = weight
+	}
+	language := config.DefaultLanguage
+	if language == "" {
+		language = "none"
+	}
+
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		panic(err)
+	}
+	var existing []bson.M
+	if err := cursor.All(ctx, &existing); err != nil {
+		panic(err)
+	}
+	for _, index := range existing {
+		if _, ok := index["weights"]; !ok {
+			continue
+		}
+		if index["name"] == textIndexName && sameWeights(index["weights"], weights) && index["default_language"] == language {
+			return
+		}
+		if _, err := collection.Indexes().DropOne(ctx, index["name"].(string)); err != nil {
+			panic(err)
+		}
+		slog.Info("Dropped text index", "phase", "indexes", "graph", collection.Name(), "index", index["name"])
+	}
+	if len(weights) == 0 {
+		return
+	}
+
+	// Fields with the highest weight first, so the key order is the same on every build.
+	fields := make([]string, 0, len(weights))
+	for field := range weights {
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if config.Weights[fields[i]] != config.Weights[fields[j]] {
+			return config.Weights[fields[i]] > config.Weights[fields[j]]
+		}
+		return fields[i] < fields[j]
+	})
+	keys := bson.D{}
+	for _, field := range fields {
+		keys = append(keys, bson.E{Key: field, Value: "text"})
+	}
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetName(textIndexName).SetWeights(weights).SetDefaultLanguage(language),
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// sameWeights compares the weights of an existing index with the configured ones.
+// The server returns the weights as int32, so the configured weights are compared as int32 as well.
+func sameWeights(existing interface{}, weights bson.M) bool {
+	current, ok := existing.(bson.M)
+	if !ok || len(current) != len(weights) {
+		return false
+	}
+	for field, weight := range weights {
+		if !reflect.DeepEqual(current[field], weight) {
+			return false
+		}
+	}
+	return true
+}
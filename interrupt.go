@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// exitInterrupted is the exit status of a build stopped by SIGINT or SIGTERM, like the shells use for SIGINT.
+const exitInterrupted = 130
+
+// interruptTimeout is how long recording the interruption may take.
+var interruptTimeout = 30 * time.Second
+
+// disconnectTimeout is how long closing a connection at the end of the build may take.
+var disconnectTimeout = 30 * time.Second
+
+// currentStep is the phase or unit the build is in, for the interruption record.
+var currentStep = struct {
+	sync.Mutex
+	name string
+}{}
+
+func setCurrentStep(name string) {
+	currentStep.Lock()
+	defer currentStep.Unlock()
+	currentStep.name = name
+}
+
+func getCurrentStep() string {
+	currentStep.Lock()
+	defer currentStep.Unlock()
+	return currentStep.name
+}
+
+// rootContext returns the context of the build, which is cancelled by SIGINT or SIGTERM.
+// The parsers stop reading and the writers stop after the document they are writing. A second signal stops the
+// builder at once.
+func rootContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case received := <-signals:
+			slog.Warn("Stopping the running step, interrupt again to stop at once", "signal", received.String())
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
+
+// interrupted records the interruption in the _build record, and exits with exitInterrupted.
+// The units completed before have their checkpoints, so the build can be resumed.
+func interrupted(client *mongo.Client) {
+	slog.Error("MetaDB Build interrupted", "step", getCurrentStep())
+	if client != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), interruptTimeout)
+		defer cancel()
+		writeBuildRecord(ctx, client, "interrupted")
+		if err := client.Disconnect(ctx); err != nil {
+			slog.Error("Error disconnecting", "err", err)
+		}
+	}
+	os.Exit(exitInterrupted)
+}
+
+// disconnect closes a connection with its own timeout, as the root context is cancelled once the build is interrupted.
+func disconnect(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+	defer cancel()
+	return client.Disconnect(ctx)
+}
+
+// stopIfInterrupted ends the build if it was interrupted, once the running step has stopped.
+func stopIfInterrupted(ctx context.Context, client *mongo.Client) {
+	if ctx.Err() != nil {
+		interrupted(client)
+	}
+}
+
+// interruptedWrite is true for a write that failed because the build was interrupted. The writers return
+// instead of panicking, and stopIfInterrupted ends the build after them.
+func interruptedWrite(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() != nil
+}
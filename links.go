@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// statementCount is an entity field counting the statements of a graph the entity is the subject of.
+type statementCount struct {
+	collection string
+	field      string
+}
+
+// statementCounts are the counts kept for the statement graphs that are only read for refScores, by graph.
+var statementCounts = map[string]statementCount{
+	"prot2bp":   {collection: "prot", field: "goAnnotationCount"},
+	"prot2cc":   {collection: "prot", field: "goAnnotationCount"},
+	"prot2mf":   {collection: "prot", field: "goAnnotationCount"},
+	"gene2phen": {collection: "gene", field: "phenotypeCount"},
+}
+
+var subjectCounts = struct {
+	sync.Mutex
+	counts map[statementCount]map[string]int
+}{counts: make(map[statementCount]map[string]int)}
+
+// countStatementSubject counts a statement for its subject, if the graph has a statement count.
+func countStatementSubject(graph string, subject string) {
+	count, ok := statementCounts[graph]
+	if !ok {
+		return
+	}
+	subjectCounts.Lock()
+	defer subjectCounts.Unlock()
+	if subjectCounts.counts[count] == nil {
+		subjectCounts.counts[count] = make(map[string]int)
+	}
+	subjectCounts.counts[count][subject]++
+}
+
+// linkEntities writes the inverse relations onto the entity documents, once everything is loaded:
+// encodedBy (the genes encoding a protein), interactsWithCount (prot2prot statements of a protein),
+// goAnnotationCount (prot2bp, prot2cc and prot2mf statements of a protein) and phenotypeCount (gene2phen statements of a gene).
+// Entities without links get an empty array or 0, so every document has the fields.
+func linkEntities(ctx context.Context, client *mongo.Client) {
+	db := client.Database("metadb")
+	defaults := map[string]bson.M{
+		"prot": {"encodedBy": bson.A{}, "interactsWithCount": 0},
+	}
+	for _, count := range statementCounts {
+		if defaults[count.collection] == nil {
+			defaults[count.collection] = bson.M{}
+		}
+		defaults[count.collection][count.field] = 0
+	}
+	for collection, fields := range defaults {
+		if _, err := db.Collection(collection).UpdateMany(ctx, bson.M{}, bson.M{"$set": fields}); err != nil {
+			panic(err)
+		}
+	}
+
+	updates := map[string]map[string]bson.M{
+		"prot": make(map[string]bson.M),
+	}
+	set := func(collection string, uri string, field string, value interface{}) {
+		if updates[collection] == nil {
+			updates[collection] = make(map[string]bson.M)
+		}
+		if updates[collection][uri] == nil {
+			updates[collection][uri] = bson.M{}
+		}
+		updates[collection][uri][field] = value
+	}
+
+	encodedBy, err := encodingGenes(ctx, db)
+	if err != nil {
+		panic(err)
+	}
+	for prot, genes := range encodedBy {
+		set("prot", prot, "encodedBy", genes)
+	}
+
+	interactions, err := endpointCounts(ctx, db.Collection("prot2prot"))
+	if err != nil {
+		panic(err)
+	}
+	for prot, count := range interactions {
+		set("prot", prot, "interactsWithCount", count)
+	}
+
+	subjectCounts.Lock()
+	for count, subjects := range subjectCounts.counts {
+		for uri, n := range subjects {
+			set(count.collection, uri, count.field, n)
+		}
+	}
+	subjectCounts.Unlock()
+
+	for collection, collectionUpdates := range updates {
+		slog.Info("Linking entities", "phase", "link", "graph", collection, "count", len(collectionUpdates))
+		if err := updateByURI(ctx, db.Collection(collection), collectionUpdates); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// encodingGenes returns the genes encoding each protein, from the encodes arrays of the gene documents.
+func encodingGenes(ctx context.Context, db *mongo.Database) (map[string][]string, error) {
+	cursor, err := db.Collection("gene").Find(ctx,
+		bson.M{"encodes.0": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"_id": 0, "uri": 1, "encodes": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	encodedBy := make(map[string][]string)
+	for cursor.Next(ctx) {
+		var gene struct {
+			URI     string   `bson:"uri"`
+			Encodes []string `bson:"encodes"`
+		}
+		if err := cursor.Decode(&gene); err != nil {
+			return nil, err
+		}
+		for _, prot := range gene.Encodes {
+			encodedBy[prot] = append(encodedBy[prot], gene.URI)
+		}
+	}
+	return encodedBy, cursor.Err()
+}
+
+// endpointCounts counts the statements of a collection each URI is the subject or object of.
+func endpointCounts(ctx context.Context, collection *mongo.Collection) (map[string]int, error) {
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$project", Value: bson.M{"endpoints": bson.A{"$subject", "$object"}}}},
+		{{Key: "$unwind", Value: "$endpoints"}},
+		{{Key: "$group", Value: bson.M{"_id": "$endpoints", "count": bson.M{"$sum": 1}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	counts := make(map[string]int)
+	for cursor.Next(ctx) {
+		var result struct {
+			URI   string `bson:"_id"`
+			Count int    `bson:"count"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+		counts[result.URI] = result.Count
+	}
+	return counts, cursor.Err()
+}
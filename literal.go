@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// untaggedLanguage is the key used for literals without a language tag.
+var untaggedLanguage = "und"
+
+// Literal is an RDF literal split into its lexical value, language tag and datatype IRI.
+type Literal struct {
+	value    string
+	lang     string
+	datatype string
+}
+
+// parseLiteral parses an object term in N-Triples form. The escapes in the value are decoded,
+// and the language tag is lowercased. Terms that are not literals (IRIs and blank nodes)
+// are returned as the value, as they were written.
+func parseLiteral(term string) Literal {
+	if !strings.HasPrefix(term, "\"") {
+		return Literal{value: term}
+	}
+	end := len(term) - 1
+	for end > 0 && term[end] != '"' {
+		end--
+	}
+	if end == 0 {
+		return Literal{value: strings.Trim(term, "\"")}
+	}
+	literal := Literal{value: unescapeNTriplesString(term[1:end])}
+	suffix := term[end+1:]
+	if strings.HasPrefix(suffix, "@") {
+		literal.lang = strings.ToLower(suffix[1:])
+	} else if strings.HasPrefix(suffix, "^^") {
+		literal.datatype = removeLTGT(suffix[2:])
+	}
+	return literal
+}
+
+// language returns the language tag of the literal, or untaggedLanguage.
+func (l Literal) language() string {
+	if l.lang == "" {
+		return untaggedLanguage
+	}
+	return l.lang
+}
+
+// unescapeNTriplesString decodes the escape sequences of an N-Triples string.
+func unescapeNTriplesString(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 >= len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'b':
+			b.WriteByte('\b')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u', 'U':
+			length := 4
+			if value[i] == 'U' {
+				length = 8
+			}
+			if i+length < len(value) {
+				if code, err := strconv.ParseUint(value[i+1:i+1+length], 16, 32); err == nil {
+					b.WriteRune(rune(code))
+					i += length
+					continue
+				}
+			}
+			b.WriteByte('\\')
+			b.WriteByte(value[i])
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// LangValues collects the values of a literal predicate per language tag, in the order they were read.
+type LangValues map[string][]string
+
+func newLangValues(literal Literal) LangValues {
+	return LangValues{literal.language(): []string{literal.value}}
+}
+
+// add returns the values with the literal added, allocating the map if needed.
+func (v LangValues) add(literal Literal) LangValues {
+	if v == nil {
+		return newLangValues(literal)
+	}
+	v[literal.language()] = append(v[literal.language()], literal.value)
+	return v
+}
+
+// languageMatches is true if tag is the wanted language or one of its subtags (en matches en-gb).
+// The wanted language * matches every tag.
+func languageMatches(tag string, wanted string) bool {
+	wanted = strings.ToLower(wanted)
+	if wanted == "*" {
+		return true
+	}
+	if wanted == "" {
+		wanted = untaggedLanguage
+	}
+	return tag == wanted || strings.HasPrefix(tag, wanted+"-")
+}
+
+// preferredLanguages returns the languages in v in the order of the manifest's fallback chain.
+// Languages outside the chain are left out.
+func (v LangValues) preferredLanguages() []string {
+	tags := make([]string, 0, len(v))
+	for tag := range v {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	languages := []string{}
+	seen := make(map[string]bool)
+	for _, wanted := range manifest.Languages {
+		for _, tag := range tags {
+			if !seen[tag] && languageMatches(tag, wanted) {
+				languages = append(languages, tag)
+				seen[tag] = true
+			}
+		}
+	}
+	return languages
+}
+
+// preferred returns the first value in the most preferred language that has one.
+func (v LangValues) preferred() string {
+	for _, tag := range v.preferredLanguages() {
+		if len(v[tag]) > 0 {
+			return v[tag][0]
+		}
+	}
+	return ""
+}
+
+// preferredAll returns the distinct values in all the preferred languages, most preferred first.
+func (v LangValues) preferredAll() []string {
+	values := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range v.preferredLanguages() {
+		for _, value := range v[tag] {
+			if !seen[value] {
+				values = append(values, value)
+				seen[value] = true
+			}
+		}
+	}
+	return values
+}
+
+// first returns the first value read in each language.
+func (v LangValues) first() map[string]string {
+	values := make(map[string]string, len(v))
+	for tag, list := range v {
+		if len(list) > 0 {
+			values[tag] = list[0]
+		}
+	}
+	return values
+}
+
+// xsdIntegerTypes are the XSD datatypes derived from xsd:integer.
+var xsdIntegerTypes = []string{
+	"integer", "int", "long", "short", "byte",
+	"nonNegativeInteger", "positiveInteger", "nonPositiveInteger", "negativeInteger",
+	"unsignedLong", "unsignedInt", "unsignedShort", "unsignedByte",
+}
+
+// convertLiteral converts a literal to the Go value matching its XSD datatype:
+// int64 for the integer types, float64 for xsd:double, xsd:float and xsd:decimal, bool for xsd:boolean
+// and time.Time for xsd:date and xsd:dateTime. Other literals are returned as strings.
+// An error is returned if the lexical form is not valid for the datatype.
+func convertLiteral(literal Literal) (interface{}, error) {
+	if !strings.HasPrefix(literal.datatype, xsdNamespace) {
+		return literal.value, nil
+	}
+	datatype := strings.TrimPrefix(literal.datatype, xsdNamespace)
+	value := strings.TrimSpace(literal.value)
+	for _, integerType := range xsdIntegerTypes {
+		if datatype == integerType {
+			number, err := strconv.ParseInt(strings.TrimPrefix(value, "+"), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid xsd:%s %q", datatype, literal.value)
+			}
+			return number, nil
+		}
+	}
+	switch datatype {
+	case "decimal":
+		number, err := parseXSDDecimal(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid xsd:decimal %q", literal.value)
+		}
+		return number, nil
+	case "double", "float":
+		number, err := parseXSDFloat(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid xsd:%s %q", datatype, literal.value)
+		}
+		return number, nil
+	case "boolean":
+		switch value {
+		case "true", "1":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid xsd:boolean %q", literal.value)
+	case "date":
+		for _, layout := range []string{"2006-01-02", "2006-01-02Z07:00"} {
+			if date, err := time.Parse(layout, value); err == nil {
+				return date, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid xsd:date %q", literal.value)
+	case "dateTime":
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+			if date, err := time.Parse(layout, value); err == nil {
+				return date, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid xsd:dateTime %q", literal.value)
+	}
+	return literal.value, nil
+}
+
+func parseXSDFloat(value string) (float64, error) {
+	switch value {
+	case "INF", "+INF":
+		return math.Inf(1), nil
+	case "-INF":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	if strings.ContainsAny(value, "xXpP_") || strings.EqualFold(value, "inf") || strings.EqualFold(value, "infinity") || strings.EqualFold(value, "nan") {
+		// Accepted by strconv, but not valid XSD.
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// parseXSDDecimal parses the lexical form of xsd:decimal, an optional sign and digits with an optional
+// decimal point. Unlike xsd:double, it has no exponent, INF or NaN.
+func parseXSDDecimal(value string) (float64, error) {
+	digits := strings.TrimLeft(value, "+-")
+	if len(value)-len(digits) > 1 {
+		return 0, fmt.Errorf("invalid decimal %q", value)
+	}
+	integer, fraction, _ := strings.Cut(digits, ".")
+	if integer == "" && fraction == "" {
+		return 0, fmt.Errorf("invalid decimal %q", value)
+	}
+	for _, part := range []string{integer, fraction} {
+		if strings.Trim(part, "0123456789") != "" {
+			return 0, fmt.Errorf("invalid decimal %q", value)
+		}
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// literalFloat returns the numeric value of a literal. Untyped literals are parsed as numbers as well.
+func literalFloat(literal Literal) (float64, error) {
+	if literal.datatype == "" {
+		number, err := parseXSDFloat(strings.TrimSpace(literal.value))
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", literal.value)
+		}
+		return number, nil
+	}
+	converted, err := convertLiteral(literal)
+	if err != nil {
+		return 0, err
+	}
+	switch number := converted.(type) {
+	case float64:
+		return number, nil
+	case int64:
+		return float64(number), nil
+	}
+	return 0, fmt.Errorf("expected a number, found %q^^<%s>", literal.value, literal.datatype)
+}
+
+// literalBool returns the boolean value of a literal. Untyped literals are parsed as xsd:boolean.
+func literalBool(literal Literal) (bool, error) {
+	if literal.datatype == "" {
+		literal.datatype = xsdNamespace + "boolean"
+	}
+	converted, err := convertLiteral(literal)
+	if err != nil {
+		return false, err
+	}
+	if value, ok := converted.(bool); ok {
+		return value, nil
+	}
+	return false, fmt.Errorf("expected a boolean, found %q^^<%s>", literal.value, literal.datatype)
+}
+
+// invalidLiteralExamples is how many invalid literals are printed per source and predicate.
+// The rest are counted and included in the summary at the end of the build.
+var invalidLiteralExamples = 10
+
+var invalidLiterals = struct {
+	sync.Mutex
+	counts map[string]int
+}{counts: make(map[string]int)}
+
+// reportInvalidLiteral records a literal whose lexical form does not match its datatype, on a line of the source file.
+func reportInvalidLiteral(source string, line int, predicate string, err error) {
+	invalidLiterals.Lock()
+	defer invalidLiterals.Unlock()
+	key := source + " " + predicate
+	invalidLiterals.counts[key]++
+	if invalidLiterals.counts[key] <= invalidLiteralExamples {
+		slog.Warn("Invalid literal", "source", source, "predicate", predicate, "line", line, "err", err)
+	}
+}
+
+// printInvalidLiteralSummary prints how many invalid literals were found per source and predicate.
+func printInvalidLiteralSummary() {
+	invalidLiterals.Lock()
+	defer invalidLiterals.Unlock()
+	keys := make([]string, 0, len(invalidLiterals.counts))
+	for key := range invalidLiterals.counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		slog.Warn("Invalid literals", "source", key, "count", invalidLiterals.counts[key])
+	}
+}
+
+// LiteralFields holds the converted values of the predicates mapped to document fields in the manifest.
+type LiteralFields map[string][]interface{}
+
+func (f LiteralFields) add(field string, value interface{}) LiteralFields {
+	if f == nil {
+		f = make(LiteralFields)
+	}
+	f[field] = append(f[field], value)
+	return f
+}
+
+// setOn adds the fields to a document. Fields with a single value are stored as that value, others as an array.
+func (f LiteralFields) setOn(doc map[string]interface{}) {
+	for field, values := range f {
+		if len(values) == 1 {
+			doc[field] = values[0]
+		} else {
+			doc[field] = values
+		}
+	}
+}
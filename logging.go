@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// logFormats are the values of -log-format.
+var logFormats = []string{"text", "json"}
+
+// setupLogging sets the default logger, which writes to stdout in the given format from the given level on.
+// The levels are debug, info, warn and error: the parsers' and writers' progress is logged at info.
+func setupLogging(format string, level string) error {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("log level %q: %w", level, err)
+	}
+	options := &slog.HandlerOptions{Level: minLevel}
+	switch format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, options)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, options)))
+	default:
+		return fmt.Errorf("log format %q is not one of %v", format, logFormats)
+	}
+	return nil
+}
+
+// rateMeter measures the rate of a count, lines read or documents written, between progress reports.
+type rateMeter struct {
+	last      time.Time
+	lastCount int
+}
+
+func newRateMeter() *rateMeter {
+	return &rateMeter{last: time.Now()}
+}
+
+// rate returns the count per second since the previous call.
+func (m *rateMeter) rate(count int) float64 {
+	now := time.Now()
+	seconds := now.Sub(m.last).Seconds()
+	rate := 0.0
+	if seconds > 0 {
+		rate = float64(count-m.lastCount) / seconds
+	}
+	m.last = now
+	m.lastCount = count
+	return float64(int64(rate*10)) / 10
+}
@@ -1,17 +1,14 @@
 package main
 
 import (
-	"bufio"
-	"compress/gzip"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -20,11 +17,9 @@ import (
 
 type Entity struct {
 	uri             string
-	lcLabel         string
-	prefLabel       string
-	definition      string
-	lcSynonyms      []string
-	synonyms        []string
+	labels          LangValues
+	definitions     LangValues
+	synonyms        LangValues
 	instances       []string
 	encodes         []string
 	fromScore       int
@@ -33,23 +28,33 @@ type Entity struct {
 	annotationScore float64
 	entityType      string
 	pubMeds         []string
+	fields          LiteralFields
+	taxa            []string
+	xrefs           []Xref
 }
 
 type SimpleEntity struct {
-	uri        string
-	lcLabel    string
-	prefLabel  string
-	definition string
+	uri         string
+	labels      LangValues
+	definitions LangValues
+	synonyms    LangValues
+	subClassOf  []string
+	deprecated  bool
+	xrefs       []Xref
 }
 
 type Statement struct {
-	uri        string
-	lcLabel    string
-	prefLabel  string
-	definition string
-	subject    string
-	object     string
-	predicate  string
+	uri            string
+	labels         LangValues
+	definitions    LangValues
+	subject        string
+	object         string
+	predicate      string
+	pubMeds        []string
+	instances      []string
+	evidenceLevels []float64
+	fields         LiteralFields
+	taxa           []string
 }
 
 var prefLabelRT = "<http://www.w3.org/2004/02/skos/core#prefLabel>"
@@ -102,120 +107,278 @@ var taxa = []string{
 // }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		runDiff(os.Args[2:])
+		return
+	}
 	if len(os.Args) < 2 {
 		panic("Missing RDF folder path!")
 	}
 	var rdfPath string
+	var manifestPath string
+	var force string
+	var previousURI string
+	var logFormat string
+	var logLevel string
 	flag.StringVar(&rdfPath, "path", "uploads", "rdf path")
 	flag.IntVar(&threadCount, "t", 10, "thread count")
+	flag.StringVar(&manifestPath, "manifest", "", "build manifest (JSON)")
+	flag.BoolVar(&indexAfterLoad, "index-after-load", false, "create the indexes after loading the data")
+	flag.BoolVar(&computeCentrality, "centrality", false, "compute degree and PageRank of proteins from prot2prot")
+	flag.BoolVar(&discoverTaxa, "discover", false, "build the taxa found in the RDF folder instead of the manifest's")
+	flag.StringVar(&validationReportPath, "validation-report", "validation.json", "path of the JSON validation report")
+	flag.StringVar(&statsPath, "stats", "stats.json", "path of the JSON build statistics")
+	flag.StringVar(&buildVersion, "version", "", "BioGateway version number, recorded in the _build collection")
+	flag.StringVar(&force, "force", "", "comma separated graphs to load even if an earlier run completed them, or all")
+	flag.StringVar(&previousURI, "previous", "", "mongodb:// URI of the MetaDB of the previous version, to copy the graphs with unchanged inputs from")
+	flag.StringVar(&logFormat, "log-format", "text", "log format, text or json")
+	flag.StringVar(&logLevel, "log-level", "info", "lowest level logged: debug, info, warn or error")
 	flag.Parse()
+	if err := setupLogging(logFormat, logLevel); err != nil {
+		panic(err)
+	}
+	if err := build(rdfPath, manifestPath, force, previousURI); err != nil {
+		slog.Error("MetaDB Build failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+// build loads the MetaDB. It returns an error if the build fails validation, after recording it in _build and
+// disconnecting.
+func build(rdfPath string, manifestPath string, force string, previousURI string) error {
+	ctx, stop := rootContext()
+	defer stop()
+	forceGraphs = parseForceGraphs(force)
 	rdfPath = strings.TrimRight(rdfPath, "/")
+	if manifestPath != "" {
+		loaded, err := loadManifest(manifestPath)
+		if err != nil {
+			panic(err)
+		}
+		manifest = loaded
+	}
+	taxonPrefix = manifest.expandCURIE("NCBITaxon:")
+	taxa = manifest.Taxa
+
+	discovery, err := discoverInputs(rdfPath)
+	if err != nil {
+		slog.Error("Error reading the RDF folder", "phase", "discover", "err", err)
+	} else {
+		if discoverTaxa {
+			taxa = discovery.taxa()
+			slog.Info("Discovered taxa", "phase", "discover", "taxa", strings.Join(taxa, ","))
+		}
+		if warnings := checkInputs(rdfPath, discovery, taxa); warnings > 0 {
+			slog.Warn("Problems with the input files, see above", "phase", "discover", "count", warnings)
+		}
+	}
+	// The Gene Ontology is loaded last, stop before loading anything rather than failing at the end.
+	if _, err := findRDFFile(rdfPath+"/onto", "go-basic"); err != nil {
+		return fmt.Errorf("cannot load the Gene Ontology: %w", err)
+	}
 
-	fmt.Print("MetaDB Generator started...\n")
+	slog.Info("MetaDB Generator started", "version", buildVersion)
+
+	var client *mongo.Client
+	// The Mongo calls of the main goroutine fail once the build is interrupted.
+	defer func() {
+		if r := recover(); r != nil {
+			if ctx.Err() == nil {
+				panic(r)
+			}
+			interrupted(client)
+		}
+	}()
 
 	mongoURI := "mongodb://localhost:27027"
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(mongoURI))
+	client, err = mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
 	if err != nil {
 		panic(err)
 	}
 	defer func() {
-		if err := client.Disconnect(context.TODO()); err != nil {
+		if err := disconnect(client); err != nil {
 			panic(err)
 		}
 	}()
 
+	if previousURI != "" {
+		previous, err := openPreviousBuild(ctx, previousURI)
+		if err != nil {
+			slog.Warn("Not building incrementally", "err", err)
+		} else {
+			defer previous.close()
+			previousBuild = previous
+		}
+	}
+
 	refScores := make(map[string]int)
 
 	// Gene Ontology
-	// parseGeneOntology(rdfPath, client)
+	// parseGeneOntology(ctx, rdfPath, client)
 
 	// Proteins and Genes for all taxa
 	for _, taxon := range taxa {
-		fmt.Println("Parsing RDFs for taxon", taxon)
-		parseEntityRDF(taxon, "prot", "http://uniprot.org/uniprot/", rdfPath, refScores, client)
-		parseEntityRDF(taxon, "gene", "http://rdf.biogateway.eu/gene", rdfPath, refScores, client)
-		// parseEntityRDF(taxon, "crm", "http://rdf.biogateway.eu/crm", rdfPath, refScores, client)
-
-		parseStatementRefScore(taxon, "prot2bp", "http://rdf.biogateway.eu/prot-onto/", rdfPath, refScores)
-		parseStatementRefScore(taxon, "prot2cc", "http://rdf.biogateway.eu/prot-onto/", rdfPath, refScores)
-		parseStatementRefScore(taxon, "prot2mf", "http://rdf.biogateway.eu/prot-onto/", rdfPath, refScores)
+		slog.Info("Parsing RDFs", "phase", "parse", "taxon", taxon)
+		endPhase := startPhase("parse " + taxon)
+		err = runUnit(ctx, client, rdfPath, "prot", taxon, refScores, func() error {
+			return parseEntityRDF(ctx, taxon, "prot", "http://uniprot.org/uniprot/", rdfPath, refScores, client)
+		})
+		if err != nil {
+			return failBuild(ctx, client, err)
+		}
+		err = runUnit(ctx, client, rdfPath, "gene", taxon, refScores, func() error {
+			return parseEntityRDF(ctx, taxon, "gene", "http://rdf.biogateway.eu/gene", rdfPath, refScores, client)
+		})
+		if err != nil {
+			return failBuild(ctx, client, err)
+		}
+		// parseEntityRDF(ctx, taxon, "crm", "http://rdf.biogateway.eu/crm", rdfPath, refScores, client)
 
-		parseStatementRDF(taxon, "prot2prot", "http://rdf.biogateway.eu/prot-prot/uniprot!", rdfPath, client)
+		parseStatementRefScore(ctx, taxon, "prot2bp", "http://rdf.biogateway.eu/prot-onto/", rdfPath, refScores)
+		parseStatementRefScore(ctx, taxon, "prot2cc", "http://rdf.biogateway.eu/prot-onto/", rdfPath, refScores)
+		parseStatementRefScore(ctx, taxon, "prot2mf", "http://rdf.biogateway.eu/prot-onto/", rdfPath, refScores)
 
+		err = runUnit(ctx, client, rdfPath, "prot2prot", taxon, refScores, func() error {
+			return parseStatementRDF(ctx, taxon, "prot2prot", "http://rdf.biogateway.eu/prot-prot/uniprot!", rdfPath, client)
+		})
+		if err != nil {
+			return failBuild(ctx, client, err)
+		}
+		endPhase()
 	}
+	endPhase := startPhase("parse diseases")
 	// We only have diseases for humans
-	parseStatementRefScore("9606", "gene2phen", "http://rdf.biogateway.eu/gene-phen/", rdfPath, refScores)
-	parseDiseases(rdfPath, refScores, client)
+	parseStatementRefScore(ctx, "9606", "gene2phen", "http://rdf.biogateway.eu/gene-phen/", rdfPath, refScores)
+	err = runUnit(ctx, client, rdfPath, "omim", "", refScores, func() error {
+		parseDiseases(ctx, rdfPath, refScores, client)
+		return nil
+	})
+	if err != nil {
+		return failBuild(ctx, client, err)
+	}
+	endPhase()
 
 	// Depends on parsing prot2bp, prot2cc and prot2mf first, to get accurate refScores.
-	parseGeneOntology(rdfPath, refScores, client)
+	endPhase = startPhase("parse goall")
+	err = runUnit(ctx, client, rdfPath, "goall", "", refScores, func() error {
+		parseGeneOntology(ctx, rdfPath, refScores, client)
+		return nil
+	})
+	if err != nil {
+		return failBuild(ctx, client, err)
+	}
+	endPhase()
+	stopIfInterrupted(ctx, client)
+
+	incrementalSummary()
+
+	endPhase = startPhase("link")
+	linkEntities(ctx, client)
+	buildTaxonCollection(ctx, rdfPath, client)
+	countCitations(ctx, client)
+	endPhase()
+	stopIfInterrupted(ctx, client)
+
+	if computeCentrality {
+		endPhase = startPhase("centrality")
+		computeInteractionCentrality(ctx, client)
+		endPhase()
+		stopIfInterrupted(ctx, client)
+	}
 
-	fmt.Printf("MetaDB Build completed...")
+	// Depends on all collections being loaded and linked, the degree scorer uses prot2prot.
+	endPhase = startPhase("rank")
+	rankCollections(ctx, client)
+	endPhase()
+	stopIfInterrupted(ctx, client)
+
+	endPhase = startPhase("indexes")
+	createDeferredIndexes(ctx, client)
+	endPhase()
+	stopIfInterrupted(ctx, client)
+
+	printInvalidLiteralSummary()
+	printDuplicateSummary()
+
+	endPhase = startPhase("validate")
+	collectBuildStats(ctx, client)
+	err = validateBuild(ctx, client)
+	endPhase()
+	stopIfInterrupted(ctx, client)
+	if err != nil {
+		return failBuild(ctx, client, err)
+	}
+	writeBuildRecord(ctx, client, "completed")
+	slog.Info("MetaDB Build completed")
+	return nil
 }
 
-func parseEntityRDF(taxon string, graph string, prefix string, rdfPath string, refScores map[string]int, client *mongo.Client) {
-	f, err := os.Open(rdfPath + "/" + graph + "/" + taxon + ".nt.gz")
+// failBuild records the build as failed, and returns err for main to exit with.
+func failBuild(ctx context.Context, client *mongo.Client, err error) error {
+	writeBuildRecord(ctx, client, "failed")
+	return err
+}
+
+func parseEntityRDF(ctx context.Context, taxon string, graph string, prefix string, rdfPath string, refScores map[string]int, client *mongo.Client) error {
+	logger := slog.With("phase", "parse", "graph", graph, "taxon", taxon)
+	path, err := findRDFFile(rdfPath+"/"+graph, taxon)
 	if err != nil {
-		fmt.Println("Error opening file: ", err)
-		return
+		logger.Error("Error opening file", "err", err)
+		return nil
 	}
-	defer f.Close()
-	// protDB := client.Database("metadb").Collection("prot")
-	lineNumber := 0
-	gzReader, err := gzip.NewReader(f)
+	logger = logger.With("file", path)
+	scanner, err := openTriples(ctx, path, graph)
 	if err != nil {
-		panic("Failed to create gzip reader: " + err.Error())
+		logger.Error("Error opening file", "err", err)
+		return nil
 	}
-	defer gzReader.Close()
-
-	scanner := bufio.NewScanner(gzReader)
+	defer scanner.Close()
+	// protDB := client.Database("metadb").Collection("prot")
+	lineNumber := 0
+	meter := newRateMeter()
 	entityMap := make(map[string]Entity)
 
 	for scanner.Scan() {
-		line := scanner.Text()
+		if ctx.Err() != nil {
+			return nil
+		}
+		triple := scanner.Triple()
 		lineNumber++
-		components := strings.SplitN(line, " ", 3)
-		sub := components[0]
-		predicate := components[1]
-		value := cleanRDFString(components[2])
+		predicate := triple.predicate
+		literal := parseLiteral(triple.object)
+		value := literal.value
 
-		uri := removeLTGT(sub)
+		uri := removeLTGT(triple.subject)
 		if !strings.HasPrefix(uri, prefix) {
 			continue
 		}
 		if predicate == prefLabelRT {
 			if entry, ok := entityMap[uri]; ok {
-				entry.prefLabel = value
-				entry.lcLabel = strings.ToLower(value)
+				entry.labels = entry.labels.add(literal)
 				entityMap[uri] = entry
 			} else {
 				entityMap[uri] = Entity{
-					uri:       uri,
-					prefLabel: value,
-					lcLabel:   strings.ToLower(value),
+					uri:    uri,
+					labels: newLangValues(literal),
 				}
 			}
 		} else if predicate == definitionRT {
 			if entry, ok := entityMap[uri]; ok {
-				entry.definition = value
+				entry.definitions = entry.definitions.add(literal)
 				entityMap[uri] = entry
 			} else {
 				entityMap[uri] = Entity{
-					uri:        uri,
-					definition: value}
+					uri:         uri,
+					definitions: newLangValues(literal)}
 			}
 		} else if predicate == synonymRT {
 			if entry, ok := entityMap[uri]; ok {
-				if len(entry.synonyms) > 0 {
-					entry.synonyms = append(entry.synonyms, value)
-				} else {
-					entry.synonyms = []string{value}
-				}
+				entry.synonyms = entry.synonyms.add(literal)
 				entityMap[uri] = entry
 			} else {
 				entityMap[uri] = Entity{
 					uri:      uri,
-					synonyms: []string{value},
+					synonyms: newLangValues(literal),
 				}
 			}
 		} else if predicate == instanceRT {
@@ -264,16 +427,37 @@ func parseEntityRDF(taxon string, graph string, prefix string, rdfPath string, r
 				}
 			}
 		} else if predicate == evidenceRT {
+			floatValue, err := literalFloat(literal)
+			if err != nil {
+				reportInvalidLiteral(taxon+"/"+graph, scanner.Line(), predicate, err)
+			} else if entry, ok := entityMap[uri]; ok {
+				entry.annotationScore = floatValue
+				entityMap[uri] = entry
+			} else {
+				entityMap[uri] = Entity{
+					uri:             uri,
+					annotationScore: floatValue}
+			}
+		} else if match, ok := manifest.XrefPredicates[removeLTGT(predicate)]; ok {
 			if entry, ok := entityMap[uri]; ok {
-				if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
-					entry.annotationScore = floatValue
-					entityMap[uri] = entry
-				}
-
+				entry.xrefs = addXref(entry.xrefs, value, match)
+				entityMap[uri] = entry
 			} else {
 				entityMap[uri] = Entity{
-					uri:        uri,
-					definition: value}
+					uri:   uri,
+					xrefs: addXref(nil, value, match)}
+			}
+		} else if field, ok := manifest.LiteralFields[removeLTGT(predicate)]; ok {
+			fieldValue, err := convertLiteral(literal)
+			if err != nil {
+				reportInvalidLiteral(taxon+"/"+graph, scanner.Line(), predicate, err)
+			} else if entry, ok := entityMap[uri]; ok {
+				entry.fields = entry.fields.add(field, fieldValue)
+				entityMap[uri] = entry
+			} else {
+				entityMap[uri] = Entity{
+					uri:    uri,
+					fields: LiteralFields(nil).add(field, fieldValue)}
 			}
 		} else if predicate == typeRT {
 			if value == classURI {
@@ -291,10 +475,23 @@ func parseEntityRDF(taxon string, graph string, prefix string, rdfPath string, r
 		}
 
 		if lineNumber%printLineNumber == 0 {
-			fmt.Printf("[%s][%s] Parsed line number %d\n", taxon, graph, lineNumber)
+			logger.Info("Parsed lines", "line", lineNumber, "rate", meter.rate(lineNumber))
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		logger.Error("Error reading file", "line", lineNumber, "err", err)
+	}
+
+	uris := make([]string, 0, len(entityMap))
+	for uri := range entityMap {
+		uris = append(uris, uri)
+	}
+	duplicates, err := duplicateTaxa(graph, taxon, uris)
+	if err != nil {
+		return err
+	}
 
+	// Scored before the merge policy is applied, a URI loaded from several taxa gets the scores of all of them.
 	for key, entity := range entityMap {
 		refScore := 0
 		if graph == "prot" {
@@ -308,363 +505,538 @@ func parseEntityRDF(taxon string, graph string, prefix string, rdfPath string, r
 				}
 			}
 		}
+		if _, ok := duplicates[key]; ok {
+			refScore += refScores[key]
+		}
 		refScores[key] = refScore
 	}
 
+	for uri, taxa := range duplicates {
+		if manifest.MergePolicy == "merge" {
+			entry := entityMap[uri]
+			entry.taxa = taxa
+			entityMap[uri] = entry
+			continue
+		}
+		delete(entityMap, uri)
+		// The document of the first taxon is kept, with the merged score.
+		_, err := client.Database("metadb").Collection(graph).UpdateOne(ctx,
+			bson.M{"uri": uri},
+			bson.M{"$set": bson.M{"refScore": refScores[uri]}})
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	entitiesPerThread := (len(entityMap) / threadCount) + 1
 	entities := make([][]Entity, threadCount)
 
 	for index, _ := range entities {
 
-		entities[index] = make([]Entity, entitiesPerThread)
+		entities[index] = make([]Entity, 0, entitiesPerThread)
 		i := 0
 		// Go through map of entities, put in list for each thread, and remove from entityMap.
 		for key, entity := range entityMap {
 			if i > entitiesPerThread-1 {
 				continue
 			}
-			entities[index][i] = entity
+			entities[index] = append(entities[index], entity)
 
 			delete(entityMap, key)
 			i++
 		}
 	}
 
+	prepareCollection(ctx, client, graph)
+	prepareCollection(ctx, client, xrefCollection)
+	prepareCollection(ctx, client, publicationCollection)
+
 	var waitGroup sync.WaitGroup
 	waitGroup.Add(threadCount)
 
 	for index, list := range entities {
 		go func(i int, list []Entity) {
 			defer waitGroup.Done()
-			insertEntitiesToDB(list, client, i, graph, taxon, refScores)
+			insertEntitiesToDB(ctx, list, client, i, graph, taxon, refScores)
 		}(index, list)
 	}
 	waitGroup.Wait()
+	return nil
 }
 
-func parseStatementRDF(taxon string, graph string, prefix string, rdfPath string, client *mongo.Client) {
-	pattern := rdfPath + "/" + graph + "/*" + taxon + ".nt.gz"
-	files, err := filepath.Glob(pattern)
+func parseStatementRDF(ctx context.Context, taxon string, graph string, prefix string, rdfPath string, client *mongo.Client) error {
+	logger := slog.With("phase", "parse", "graph", graph, "taxon", taxon)
+	files, err := globRDFFiles(rdfPath+"/"+graph, "*"+taxon)
 	if err != nil {
-		fmt.Println("Error matching files:", err)
-		return
+		logger.Error("Error matching files", "err", err)
+		return nil
 	}
 	for _, filePath := range files {
-		fmt.Println("Processing file:", filePath)
-
-		f, err := os.Open(filePath)
-		if err != nil {
-			fmt.Println("Error opening file: ", err)
-			return
+		err := parseStatementFile(ctx, taxon, graph, prefix, filePath, logger.With("file", filePath), client)
+		if errors.Is(err, errDuplicateURIs) {
+			return err
 		}
-		defer f.Close()
-		lineNumber := 0
-
-		gzReader, err := gzip.NewReader(f)
 		if err != nil {
-			panic("Failed to create gzip reader: " + err.Error())
+			logger.Error("Error opening file", "file", filePath, "err", err)
+			return nil
 		}
-		defer gzReader.Close()
-		scanner := bufio.NewScanner(gzReader)
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+	return nil
+}
 
-		statementMap := make(map[string]Statement)
+// parseStatementFile loads the statements of one file of a statement graph. The file is closed, and recorded as an
+// input, before the next one is read.
+func parseStatementFile(ctx context.Context, taxon string, graph string, prefix string, filePath string, logger *slog.Logger, client *mongo.Client) error {
+	logger.Info("Processing file")
 
-		for scanner.Scan() {
-			line := scanner.Text()
-			lineNumber++
-			components := strings.SplitN(line, " ", 3)
-			sub := components[0]
-			predicate := components[1]
-			value := cleanRDFString(components[2])
+	scanner, err := openTriples(ctx, filePath, graph)
+	if err != nil {
+		return err
+	}
+	defer scanner.Close()
+	lineNumber := 0
+	meter := newRateMeter()
 
-			uri := removeLTGT(sub)
-			if !strings.HasPrefix(uri, prefix) {
-				continue
-			}
-			if predicate == prefLabelRT {
-				if entry, ok := statementMap[uri]; ok {
-					entry.prefLabel = value
-					entry.lcLabel = strings.ToLower(value)
-					statementMap[uri] = entry
-				} else {
-					statementMap[uri] = Statement{
-						uri:       uri,
-						prefLabel: value,
-						lcLabel:   strings.ToLower(value),
-					}
-				}
-			} else if predicate == definitionRT {
-				if entry, ok := statementMap[uri]; ok {
-					entry.definition = value
-					statementMap[uri] = entry
-				} else {
-					statementMap[uri] = Statement{
-						uri:        uri,
-						definition: value}
-				}
-			} else if predicate == statementPredicate {
-				if entry, ok := statementMap[uri]; ok {
-					entry.predicate = removeLTGT(value)
-					statementMap[uri] = entry
-				} else {
-					statementMap[uri] = Statement{
-						uri:       uri,
-						predicate: removeLTGT(value)}
-				}
-			} else if predicate == statementObject {
-				if entry, ok := statementMap[uri]; ok {
-					entry.object = removeLTGT(value)
-					statementMap[uri] = entry
-				} else {
-					statementMap[uri] = Statement{
-						uri:    uri,
-						object: removeLTGT(value)}
-				}
-			} else if predicate == statementSubject {
-				if entry, ok := statementMap[uri]; ok {
-					entry.subject = removeLTGT(value)
-					statementMap[uri] = entry
-				} else {
-					statementMap[uri] = Statement{
-						uri:     uri,
-						subject: removeLTGT(value)}
+	statementMap := make(map[string]Statement)
+
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return nil
+		}
+		triple := scanner.Triple()
+		lineNumber++
+		predicate := triple.predicate
+		literal := parseLiteral(triple.object)
+		value := literal.value
+
+		uri := removeLTGT(triple.subject)
+		if !strings.HasPrefix(uri, prefix) {
+			continue
+		}
+		if predicate == prefLabelRT {
+			if entry, ok := statementMap[uri]; ok {
+				entry.labels = entry.labels.add(literal)
+				statementMap[uri] = entry
+			} else {
+				statementMap[uri] = Statement{
+					uri:    uri,
+					labels: newLangValues(literal),
 				}
 			}
-			if lineNumber%printLineNumber == 0 {
-				fmt.Printf("[%s][%s] Parsed line number %d\n", taxon, graph, lineNumber)
+		} else if predicate == definitionRT {
+			if entry, ok := statementMap[uri]; ok {
+				entry.definitions = entry.definitions.add(literal)
+				statementMap[uri] = entry
+			} else {
+				statementMap[uri] = Statement{
+					uri:         uri,
+					definitions: newLangValues(literal)}
+			}
+		} else if predicate == statementPredicate {
+			if entry, ok := statementMap[uri]; ok {
+				entry.predicate = removeLTGT(value)
+				statementMap[uri] = entry
+			} else {
+				statementMap[uri] = Statement{
+					uri:       uri,
+					predicate: removeLTGT(value)}
+			}
+		} else if predicate == statementObject {
+			if entry, ok := statementMap[uri]; ok {
+				entry.object = removeLTGT(value)
+				statementMap[uri] = entry
+			} else {
+				statementMap[uri] = Statement{
+					uri:    uri,
+					object: removeLTGT(value)}
+			}
+		} else if predicate == statementSubject {
+			if entry, ok := statementMap[uri]; ok {
+				entry.subject = removeLTGT(value)
+				statementMap[uri] = entry
+			} else {
+				statementMap[uri] = Statement{
+					uri:     uri,
+					subject: removeLTGT(value)}
+			}
+		} else if predicate == instanceRT {
+			instanceURI := removeLTGT(value)
+			if entry, ok := statementMap[uri]; ok {
+				entry.instances = append(entry.instances, instanceURI)
+				statementMap[uri] = entry
+			} else {
+				statementMap[uri] = Statement{
+					uri:       uri,
+					instances: []string{instanceURI}}
+			}
+		} else if predicate == evidenceRT {
+			floatValue, err := literalFloat(literal)
+			if err != nil {
+				reportInvalidLiteral(taxon+"/"+graph, scanner.Line(), predicate, err)
+			} else if entry, ok := statementMap[uri]; ok {
+				entry.evidenceLevels = append(entry.evidenceLevels, floatValue)
+				statementMap[uri] = entry
+			} else {
+				statementMap[uri] = Statement{
+					uri:            uri,
+					evidenceLevels: []float64{floatValue}}
+			}
+		} else if predicate == pubMedRT {
+			pubMedURI := removeLTGT(value)
+			if entry, ok := statementMap[uri]; ok {
+				entry.pubMeds = append(entry.pubMeds, pubMedURI)
+				statementMap[uri] = entry
+			} else {
+				statementMap[uri] = Statement{
+					uri:     uri,
+					pubMeds: []string{pubMedURI}}
 			}
+		} else if field, ok := manifest.LiteralFields[removeLTGT(predicate)]; ok {
+			fieldValue, err := convertLiteral(literal)
+			if err != nil {
+				reportInvalidLiteral(taxon+"/"+graph, scanner.Line(), predicate, err)
+			} else if entry, ok := statementMap[uri]; ok {
+				entry.fields = entry.fields.add(field, fieldValue)
+				statementMap[uri] = entry
+			} else {
+				statementMap[uri] = Statement{
+					uri:    uri,
+					fields: LiteralFields(nil).add(field, fieldValue)}
+			}
+		}
+		if lineNumber%printLineNumber == 0 {
+			logger.Info("Parsed lines", "line", lineNumber, "rate", meter.rate(lineNumber))
 		}
-		entitiesPerThread := (len(statementMap) / threadCount) + 1
-		entities := make([][]Statement, threadCount)
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Error("Error reading file", "line", lineNumber, "err", err)
+	}
+	uris := make([]string, 0, len(statementMap))
+	for uri := range statementMap {
+		uris = append(uris, uri)
+	}
+	duplicates, err := duplicateTaxa(graph, taxon, uris)
+	if err != nil {
+		return err
+	}
+	for uri, taxa := range duplicates {
+		if manifest.MergePolicy == "merge" {
+			entry := statementMap[uri]
+			entry.taxa = taxa
+			statementMap[uri] = entry
+		} else {
+			delete(statementMap, uri)
+		}
+	}
 
-		for index, _ := range entities {
-			entities[index] = make([]Statement, entitiesPerThread)
-			i := 0
-			for key, statement := range statementMap {
-				if i > entitiesPerThread-1 {
-					continue
-				}
-				entities[index][i] = statement
-				delete(statementMap, key)
-				i++
+	entitiesPerThread := (len(statementMap) / threadCount) + 1
+	entities := make([][]Statement, threadCount)
+
+	for index, _ := range entities {
+		entities[index] = make([]Statement, 0, entitiesPerThread)
+		i := 0
+		for key, statement := range statementMap {
+			if i > entitiesPerThread-1 {
+				continue
 			}
+			entities[index] = append(entities[index], statement)
+			delete(statementMap, key)
+			i++
 		}
+	}
 
-		var waitGroup sync.WaitGroup
-		waitGroup.Add(threadCount)
+	prepareCollection(ctx, client, graph)
+	prepareCollection(ctx, client, publicationCollection)
 
-		for index, list := range entities {
-			go func(i int, list []Statement) {
-				defer waitGroup.Done()
-				insertStatementsToDB(list, client, i, graph, taxon)
-			}(index, list)
-		}
-		waitGroup.Wait()
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(threadCount)
+
+	for index, list := range entities {
+		go func(i int, list []Statement) {
+			defer waitGroup.Done()
+			insertStatementsToDB(ctx, list, client, i, graph, taxon)
+		}(index, list)
 	}
+	waitGroup.Wait()
+	return nil
 }
 
-func parseStatementRefScore(taxon string, graph string, prefix string, rdfPath string, refScores map[string]int) {
-	f, err := os.Open(rdfPath + "/" + graph + "/" + taxon + ".nt.gz")
+func parseStatementRefScore(ctx context.Context, taxon string, graph string, prefix string, rdfPath string, refScores map[string]int) {
+	logger := slog.With("phase", "parse", "graph", graph, "taxon", taxon)
+	path, err := findRDFFile(rdfPath+"/"+graph, taxon)
 	if err != nil {
-		fmt.Println("Error opening file: ", err)
+		logger.Error("Error opening file", "err", err)
 		return
 	}
-
-	lineNumber := 0
-	gzReader, err := gzip.NewReader(f)
+	logger = logger.With("file", path)
+	scanner, err := openTriples(ctx, path, graph)
 	if err != nil {
-		panic("Failed to create gzip reader: " + err.Error())
+		logger.Error("Error opening file", "err", err)
+		return
 	}
-	defer gzReader.Close()
-	scanner := bufio.NewScanner(gzReader)
+	defer scanner.Close()
 
+	lineNumber := 0
+	meter := newRateMeter()
 	for scanner.Scan() {
-		line := scanner.Text()
+		if ctx.Err() != nil {
+			return
+		}
+		triple := scanner.Triple()
 		lineNumber++
-		components := strings.SplitN(line, " ", 3)
-		sub := components[0]
-		predicate := components[1]
-		value := cleanRDFString(components[2])
+		predicate := triple.predicate
+		value := cleanRDFString(triple.object)
 
-		uri := removeLTGT(sub)
+		uri := removeLTGT(triple.subject)
 		if !strings.HasPrefix(uri, prefix) {
 			continue
 		}
 		if predicate == statementObject {
 			object := removeLTGT(value)
 			refScores[object] += 1
+			countRefScoreStatement(graph, taxon)
+		}
+		if predicate == statementSubject {
+			countStatementSubject(graph, removeLTGT(value))
 		}
 		if lineNumber%printLineNumber == 0 {
-			fmt.Printf("[%s][%s] Parsed line number %d\n", taxon, graph, lineNumber)
+			logger.Info("Parsed lines", "line", lineNumber, "rate", meter.rate(lineNumber))
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		logger.Error("Error reading file", "line", lineNumber, "err", err)
+	}
 }
 
-func parseGeneOntology(rdfPath string, refScores map[string]int, client *mongo.Client) {
-	oboDefinitionRT := "<http://purl.obolibrary.org/obo/IAO_0000115>"
-
-	f, err := os.Open(rdfPath + "/onto/go-basic.nt.gz")
+// parseGeneOntology reads onto/go-basic, either as RDF or directly from the OBO or OWL functional syntax release files.
+func parseGeneOntology(ctx context.Context, rdfPath string, refScores map[string]int, client *mongo.Client) {
+	logger := slog.With("phase", "parse", "graph", "goall")
+	path, err := findRDFFile(rdfPath+"/onto", "go-basic")
 	if err != nil {
-		// fmt.Print("Error opening file: ", err)
-		panic("Error opening /go/go-basic.nt.gz: " + err.Error())
+		logger.Error("Error opening file", "err", err)
+		return
 	}
-	defer f.Close()
-	lineNumber := 0
-
-	gzReader, err := gzip.NewReader(f)
+	logger = logger.With("file", path)
+	scanner, err := openTriples(ctx, path, "goall")
 	if err != nil {
-		panic("Failed to create gzip reader: " + err.Error())
+		logger.Error("Error opening file", "err", err)
+		return
 	}
-	defer gzReader.Close()
-	scanner := bufio.NewScanner(gzReader)
+	defer scanner.Close()
+	lineNumber := 0
+	meter := newRateMeter()
 
 	entityMap := make(map[string]SimpleEntity)
 
 	for scanner.Scan() {
-		line := scanner.Text()
-		lineNumber++
-		components := strings.SplitN(line, " ", 3)
-		if len(components) < 3 {
-			continue
+		if ctx.Err() != nil {
+			return
 		}
-		sub := components[0]
-		predicate := components[1]
-		value := cleanRDFString(components[2])
+		triple := scanner.Triple()
+		lineNumber++
+		predicate := triple.predicate
+		literal := parseLiteral(triple.object)
+		value := literal.value
 
-		uri := removeLTGT(sub)
+		uri := removeLTGT(triple.subject)
 		if !strings.HasPrefix(uri, "http://purl.obolibrary.org/obo") {
 			continue
 		}
 		if predicate == labelRT {
 			if entry, ok := entityMap[uri]; ok {
-				entry.prefLabel = value
-				entry.lcLabel = strings.ToLower(value)
+				entry.labels = entry.labels.add(literal)
 				entityMap[uri] = entry
 			} else {
 				entityMap[uri] = SimpleEntity{
-					uri:       uri,
-					prefLabel: value,
-					lcLabel:   strings.ToLower(value),
+					uri:    uri,
+					labels: newLangValues(literal),
 				}
 			}
 		} else if predicate == oboDefinitionRT {
 			if entry, ok := entityMap[uri]; ok {
-				entry.definition = value
+				entry.definitions = entry.definitions.add(literal)
+				entityMap[uri] = entry
+			} else {
+				entityMap[uri] = SimpleEntity{
+					uri:         uri,
+					definitions: newLangValues(literal)}
+			}
+		} else if isSynonymRT(predicate) {
+			if entry, ok := entityMap[uri]; ok {
+				entry.synonyms = entry.synonyms.add(literal)
+				entityMap[uri] = entry
+			} else {
+				entityMap[uri] = SimpleEntity{
+					uri:      uri,
+					synonyms: newLangValues(literal),
+				}
+			}
+		} else if predicate == subClassOfRT && strings.HasPrefix(value, "<") {
+			// Anonymous superclasses (restrictions) are not part of the hierarchy.
+			parentURI := removeLTGT(value)
+			if entry, ok := entityMap[uri]; ok {
+				entry.subClassOf = append(entry.subClassOf, parentURI)
+				entityMap[uri] = entry
+			} else {
+				entityMap[uri] = SimpleEntity{
+					uri:        uri,
+					subClassOf: []string{parentURI},
+				}
+			}
+		} else if predicate == deprecatedRT {
+			deprecated, err := literalBool(literal)
+			if err != nil {
+				reportInvalidLiteral("GeneOntology", scanner.Line(), predicate, err)
+			} else if entry, ok := entityMap[uri]; ok {
+				entry.deprecated = deprecated
 				entityMap[uri] = entry
 			} else {
 				entityMap[uri] = SimpleEntity{
 					uri:        uri,
-					definition: value}
+					deprecated: deprecated,
+				}
+			}
+		} else if match, ok := manifest.XrefPredicates[removeLTGT(predicate)]; ok {
+			if entry, ok := entityMap[uri]; ok {
+				entry.xrefs = addXref(entry.xrefs, value, match)
+				entityMap[uri] = entry
+			} else {
+				entityMap[uri] = SimpleEntity{
+					uri:   uri,
+					xrefs: addXref(nil, value, match),
+				}
 			}
 		}
 		if lineNumber%printLineNumber == 0 {
-			fmt.Println("[GeneOntology] Parsed line number", lineNumber)
+			logger.Info("Parsed lines", "line", lineNumber, "rate", meter.rate(lineNumber))
 		}
 	}
-	fmt.Println("Parsing complete!")
+	if err := scanner.Err(); err != nil {
+		logger.Error("Error reading file", "line", lineNumber, "err", err)
+	}
+	logger.Info("Parsing complete", "line", lineNumber, "count", len(entityMap))
 	entitiesPerThread := (len(entityMap) / threadCount) + 1
 	entities := make([][]SimpleEntity, threadCount)
 
 	for index, _ := range entities {
-		entities[index] = make([]SimpleEntity, entitiesPerThread)
+		entities[index] = make([]SimpleEntity, 0, entitiesPerThread)
 		i := 0
 		for key, prot := range entityMap {
 			if i > entitiesPerThread-1 {
 				continue
 			}
-			entities[index][i] = prot
+			entities[index] = append(entities[index], prot)
 			delete(entityMap, key)
 			i++
 		}
 	}
 
+	prepareCollection(ctx, client, "goall")
+	prepareCollection(ctx, client, xrefCollection)
+
 	var waitGroup sync.WaitGroup
 	waitGroup.Add(threadCount)
 
 	for index, list := range entities {
 		go func(i int, list []SimpleEntity) {
 			defer waitGroup.Done()
-			insertSimpleEntitiesToDB(list, client, i, "goall", refScores)
+			insertSimpleEntitiesToDB(ctx, list, client, i, "goall", refScores)
 		}(index, list)
 	}
 	waitGroup.Wait()
 }
 
-func parseDiseases(rdfPath string, refScores map[string]int, client *mongo.Client) {
-	f, err := os.Open(rdfPath + "/onto/omim.nt.gz")
+func parseDiseases(ctx context.Context, rdfPath string, refScores map[string]int, client *mongo.Client) {
+	logger := slog.With("phase", "parse", "graph", "omim")
+	path, err := findRDFFile(rdfPath+"/onto", "omim")
 	if err != nil {
-		fmt.Println("Error opening file: ", err)
+		logger.Error("Error opening file", "err", err)
 		return
 	}
-	defer f.Close()
-	lineNumber := 0
-
-	gzReader, err := gzip.NewReader(f)
+	logger = logger.With("file", path)
+	scanner, err := openTriples(ctx, path, "omim")
 	if err != nil {
-		panic("Failed to create gzip reader: " + err.Error())
+		logger.Error("Error opening file", "err", err)
+		return
 	}
-	defer gzReader.Close()
-	scanner := bufio.NewScanner(gzReader)
+	defer scanner.Close()
+	lineNumber := 0
+	meter := newRateMeter()
 
 	entityMap := make(map[string]SimpleEntity)
 
 	for scanner.Scan() {
-		line := scanner.Text()
-		lineNumber++
-		components := strings.SplitN(line, " ", 3)
-		if len(components) < 3 {
-			continue
+		if ctx.Err() != nil {
+			return
 		}
-		sub := components[0]
-		predicate := components[1]
-		value := cleanRDFString(components[2])
+		triple := scanner.Triple()
+		lineNumber++
+		predicate := triple.predicate
+		literal := parseLiteral(triple.object)
 
-		uri := removeLTGT(sub)
+		uri := removeLTGT(triple.subject)
 		if !strings.HasPrefix(uri, "http://purl.bioontology.org/ontology/") {
 			continue
 		}
 
 		if predicate == prefLabelRT {
 			if entry, ok := entityMap[uri]; ok {
-				entry.prefLabel = value
-				entry.lcLabel = strings.ToLower(value)
+				entry.labels = entry.labels.add(literal)
 				entityMap[uri] = entry
 			} else {
 				entityMap[uri] = SimpleEntity{
-					uri:       uri,
-					prefLabel: value,
-					lcLabel:   strings.ToLower(value),
+					uri:    uri,
+					labels: newLangValues(literal),
+				}
+			}
+		} else if match, ok := manifest.XrefPredicates[removeLTGT(predicate)]; ok {
+			if entry, ok := entityMap[uri]; ok {
+				entry.xrefs = addXref(entry.xrefs, literal.value, match)
+				entityMap[uri] = entry
+			} else {
+				entityMap[uri] = SimpleEntity{
+					uri:   uri,
+					xrefs: addXref(nil, literal.value, match),
 				}
 			}
 		}
 		if lineNumber%printLineNumber == 0 {
-			fmt.Println("[Omim] Parsed line number", lineNumber)
+			logger.Info("Parsed lines", "line", lineNumber, "rate", meter.rate(lineNumber))
 		}
 	}
-	fmt.Println("Parsing complete!")
+	if err := scanner.Err(); err != nil {
+		logger.Error("Error reading file", "line", lineNumber, "err", err)
+	}
+	logger.Info("Parsing complete", "line", lineNumber, "count", len(entityMap))
 	entitiesPerThread := (len(entityMap) / threadCount) + 1
 	entities := make([][]SimpleEntity, threadCount)
 
 	for index, _ := range entities {
-		entities[index] = make([]SimpleEntity, entitiesPerThread)
+		entities[index] = make([]SimpleEntity, 0, entitiesPerThread)
 		i := 0
 		for key, prot := range entityMap {
 			if i > entitiesPerThread-1 {
 				continue
 			}
-			entities[index][i] = prot
+			entities[index] = append(entities[index], prot)
 			delete(entityMap, key)
 			i++
 		}
 	}
 
+	prepareCollection(ctx, client, "omim")
+	prepareCollection(ctx, client, xrefCollection)
+
 	var waitGroup sync.WaitGroup
 	waitGroup.Add(threadCount)
 
 	for index, list := range entities {
 		go func(i int, list []SimpleEntity) {
 			defer waitGroup.Done()
-			insertSimpleEntitiesToDB(list, client, i, "omim", refScores)
+			insertSimpleEntitiesToDB(ctx, list, client, i, "omim", refScores)
 		}(index, list)
 	}
 	waitGroup.Wait()
@@ -677,190 +1049,221 @@ func removeLTGT(value string) string {
 /*
  */
 
-func insertStatementsToDB(statements []Statement, client *mongo.Client, index int, graph string, taxon string) {
+func insertStatementsToDB(ctx context.Context, statements []Statement, client *mongo.Client, index int, graph string, taxon string) {
 	updateOptions := options.Update().SetUpsert(true)
 	// insertOptions := options.InsertOne().SetBypassDocumentValidation(true)
 	collection := client.Database("metadb").Collection(graph)
-	dbIndices := []mongo.IndexModel{
-		{Keys: bson.M{"uri": 1}},
-		{Keys: bson.M{"lcLabel": 1}},
-		{Keys: bson.M{"subject": 1}},
-		{Keys: bson.M{"object": 1}},
-		{Keys: bson.M{"predicate": 1}},
-		{Keys: bson.M{"taxon": 1}},
-	}
-
-	_, err := collection.Indexes().CreateMany(context.TODO(), dbIndices)
-	if err != nil {
-		panic(err)
-	}
+	publicationDB := client.Database("metadb").Collection(publicationCollection)
 	statementNumber := 0
-	timestamp := time.Now().Unix()
+	logger := slog.With("phase", "write", "graph", graph, "taxon", taxon, "worker", index)
+	meter := newRateMeter()
 	for _, statement := range statements {
+		if ctx.Err() != nil {
+			return
+		}
 		statementNumber++
 
+		prefLabel := statement.labels.preferred()
+
 		doc := bson.M{
-			"uri":        statement.uri,
-			"prefLabel":  statement.prefLabel,
-			"lcLabel":    statement.lcLabel,
-			"definition": statement.definition,
-			"subject":    statement.subject,
-			"object":     statement.object,
-			"predicate":  statement.predicate,
-			"taxon":      taxonPrefix + taxon,
+			"uri":               statement.uri,
+			"prefLabel":         prefLabel,
+			"lcLabel":           strings.ToLower(prefLabel),
+			"normLabel":         normalizeSearchText(prefLabel),
+			"definition":        statement.definitions.preferred(),
+			"labelsByLang":      statement.labels.first(),
+			"definitionsByLang": statement.definitions.first(),
+			"subject":           statement.subject,
+			"object":            statement.object,
+			"predicate":         statement.predicate,
+			"taxon":             taxonField(taxon, statement.taxa),
+			"evidenceOrigins":   statement.instances,
+			"sources":           evidenceSources(statement.instances),
+			"pubMedRefs":        pubMedIDs(statement.pubMeds),
+		}
+		if len(statement.evidenceLevels) > 0 {
+			doc["evidenceLevel"] = maxEvidenceLevel(statement.evidenceLevels)
 		}
+		setCURIE(doc, statement.uri)
+		statement.fields.setOn(doc)
 		_, err := collection.UpdateOne(
-			context.TODO(),
+			ctx,
 			bson.M{"uri": statement.uri},
 			bson.M{"$set": doc},
 			updateOptions)
+		if interruptedWrite(ctx, err) {
+			return
+		}
 		if err != nil {
 			panic(err)
 		}
+		insertCitationsToDB(ctx, publicationDB, statement.uri, "statements", statement.pubMeds)
 		if statementNumber%1000 == 0 {
-			nowTime := time.Now().Unix()
-			duration := nowTime - timestamp
-			timestamp = nowTime
-			fmt.Println("Thread", index, "Inserted", statementNumber, "into mongoDB graph", graph, "in", duration, "seconds")
+			logger.Info("Inserted documents", "count", statementNumber, "rate", meter.rate(statementNumber))
 		}
 	}
 }
 
-func insertSimpleEntitiesToDB(entities []SimpleEntity, client *mongo.Client, index int, graph string, refScores map[string]int) {
+func insertSimpleEntitiesToDB(ctx context.Context, entities []SimpleEntity, client *mongo.Client, index int, graph string, refScores map[string]int) {
 	updateOptions := options.Update().SetUpsert(true)
 	// insertOptions := options.InsertOne().SetBypassDocumentValidation(true)
 	entityDB := client.Database("metadb").Collection(graph)
-	dbIndices := []mongo.IndexModel{
-		{Keys: bson.M{"uri": 1}},
-		{Keys: bson.M{"lcLabel": 1}},
-		{Keys: bson.M{"lcSynonyms": 1}},
-		{Keys: bson.M{"refScore": 1}},
-		{Keys: bson.M{"definition": "text"}},
-	}
-
-	_, err := entityDB.Indexes().CreateMany(context.TODO(), dbIndices)
-	if err != nil {
-		panic(err)
-	}
+	xrefDB := client.Database("metadb").Collection(xrefCollection)
 	entityNumber := 0
-	timestamp := time.Now().Unix()
+	logger := slog.With("phase", "write", "graph", graph, "worker", index)
+	meter := newRateMeter()
 	for _, entity := range entities {
+		if ctx.Err() != nil {
+			return
+		}
 		entityNumber++
 		refScore := refScores[entity.uri]
 
+		prefLabel := entity.labels.preferred()
+		synonyms := entity.synonyms.preferredAll()
+		lcSynonyms := []string{}
+		for _, v := range synonyms {
+			lcSynonyms = append(lcSynonyms, strings.ToLower(v))
+		}
+		tokens, prefixes := searchTokens(append([]string{prefLabel}, synonyms...))
+
 		doc := bson.M{
-			"uri":        entity.uri,
-			"prefLabel":  entity.prefLabel,
-			"lcLabel":    entity.lcLabel,
-			"definition": entity.definition,
-			"refScore":   refScore,
-			// "pubMedRefs":      entity.pubMeds,
+			"uri":               entity.uri,
+			"prefLabel":         prefLabel,
+			"lcLabel":           strings.ToLower(prefLabel),
+			"normLabel":         normalizeSearchText(prefLabel),
+			"definition":        entity.definitions.preferred(),
+			"synonyms":          synonyms,
+			"lcSynonyms":        lcSynonyms,
+			"normSynonyms":      normalizeSearchTexts(synonyms),
+			"tokens":            tokens,
+			"prefixes":          prefixes,
+			"labelsByLang":      entity.labels.first(),
+			"synonymsByLang":    entity.synonyms,
+			"definitionsByLang": entity.definitions.first(),
+			"subClassOf":        entity.subClassOf,
+			"deprecated":        entity.deprecated,
+			"refScore":          refScore,
+			"xrefs":             xrefIDs(entity.xrefs),
 		}
+		setCURIE(doc, entity.uri)
 		_, err := entityDB.UpdateOne(
-			context.TODO(),
+			ctx,
 			bson.M{"uri": entity.uri},
 			bson.M{"$set": doc},
 			updateOptions)
+		if interruptedWrite(ctx, err) {
+			return
+		}
 		if err != nil {
 			panic(err)
 		}
+		insertXrefsToDB(ctx, xrefDB, entity.uri, graph, nil, entity.xrefs)
 		if entityNumber%10000 == 0 {
-			nowTime := time.Now().Unix()
-			duration := nowTime - timestamp
-			timestamp = nowTime
-			fmt.Println("Thread", index, "Inserted", entityNumber, "into mongoDB graph", graph, "in", duration, "seconds")
+			logger.Info("Inserted documents", "count", entityNumber, "rate", meter.rate(entityNumber))
 		}
 	}
 }
 
-func insertEntitiesToDB(entities []Entity, client *mongo.Client, index int, graph string, taxon string, refScores map[string]int) {
+func insertEntitiesToDB(ctx context.Context, entities []Entity, client *mongo.Client, index int, graph string, taxon string, refScores map[string]int) {
 	updateOptions := options.Update().SetUpsert(true)
 	// insertOptions := options.InsertOne().SetBypassDocumentValidation(true)
 	entityDB := client.Database("metadb").Collection(graph)
-	dbIndices := []mongo.IndexModel{
-		{Keys: bson.M{"uri": 1}},
-		{Keys: bson.M{"lcLabel": 1}},
-		{Keys: bson.M{"lcSynonyms": 1}},
-		{Keys: bson.M{"refScore": 1}},
-		{Keys: bson.M{"taxon": 1}},
-		{Keys: bson.M{"definition": "text"}},
-		{Keys: bson.M{"instances": 1}},
-	}
-	if graph == "gene" {
-		geneIndices := []mongo.IndexModel{
-			{Keys: bson.M{"encodes": 1}},
-		}
-		dbIndices = append(dbIndices, geneIndices...)
-	}
-
-	_, err := entityDB.Indexes().CreateMany(context.TODO(), dbIndices)
-	if err != nil {
-		panic(err)
-	}
+	xrefDB := client.Database("metadb").Collection(xrefCollection)
+	publicationDB := client.Database("metadb").Collection(publicationCollection)
 	entityNumber := 0
-	timestamp := time.Now().Unix()
+	logger := slog.With("phase", "write", "graph", graph, "taxon", taxon, "worker", index)
+	meter := newRateMeter()
 	for _, entity := range entities {
+		if ctx.Err() != nil {
+			return
+		}
 		entityNumber++
 		refScore := refScores[entity.uri]
 
+		prefLabel := entity.labels.preferred()
+		synonyms := entity.synonyms.preferredAll()
 		lcSynonyms := []string{}
-		for _, v := range entity.synonyms {
+		for _, v := range synonyms {
 			lcSynonyms = append(lcSynonyms, strings.ToLower(v))
 		}
+		tokens, prefixes := searchTokens(append([]string{prefLabel}, synonyms...))
 
 		var doc bson.M
 
 		if graph == "prot" {
 			doc = bson.M{
-				"uri":             entity.uri,
-				"prefLabel":       entity.prefLabel,
-				"lcLabel":         entity.lcLabel,
-				"definition":      entity.definition,
-				"annotationScore": entity.annotationScore,
-				"synonyms":        entity.synonyms,
-				"lcSynonyms":      lcSynonyms,
-				"instances":       entity.instances,
-				"taxon":           taxonPrefix + taxon,
-				"refScore":        refScore,
+				"uri":               entity.uri,
+				"prefLabel":         prefLabel,
+				"lcLabel":           strings.ToLower(prefLabel),
+				"normLabel":         normalizeSearchText(prefLabel),
+				"definition":        entity.definitions.preferred(),
+				"annotationScore":   entity.annotationScore,
+				"pubMedCount":       len(entity.pubMeds),
+				"synonyms":          synonyms,
+				"lcSynonyms":        lcSynonyms,
+				"normSynonyms":      normalizeSearchTexts(synonyms),
+				"tokens":            tokens,
+				"prefixes":          prefixes,
+				"labelsByLang":      entity.labels.first(),
+				"synonymsByLang":    entity.synonyms,
+				"definitionsByLang": entity.definitions.first(),
+				"instances":         entity.instances,
+				"taxon":             taxonField(taxon, entity.taxa),
+				"refScore":          refScore,
 			}
 		} else {
 			doc = bson.M{
-				"uri":             entity.uri,
-				"prefLabel":       entity.prefLabel,
-				"lcLabel":         entity.lcLabel,
-				"definition":      entity.definition,
-				"annotationScore": entity.annotationScore,
-				"synonyms":        entity.synonyms,
-				"lcSynonyms":      lcSynonyms,
-				"instances":       entity.instances,
-				"taxon":           taxonPrefix + taxon,
-				"refScore":        refScore,
-				"encodes":         entity.encodes,
+				"uri":               entity.uri,
+				"prefLabel":         prefLabel,
+				"lcLabel":           strings.ToLower(prefLabel),
+				"normLabel":         normalizeSearchText(prefLabel),
+				"definition":        entity.definitions.preferred(),
+				"annotationScore":   entity.annotationScore,
+				"synonyms":          synonyms,
+				"lcSynonyms":        lcSynonyms,
+				"normSynonyms":      normalizeSearchTexts(synonyms),
+				"tokens":            tokens,
+				"prefixes":          prefixes,
+				"labelsByLang":      entity.labels.first(),
+				"synonymsByLang":    entity.synonyms,
+				"definitionsByLang": entity.definitions.first(),
+				"instances":         entity.instances,
+				"taxon":             taxonField(taxon, entity.taxa),
+				"refScore":          refScore,
+				"encodes":           entity.encodes,
 			}
 		}
 
+		doc["xrefs"] = xrefIDs(entity.xrefs)
+		if manifest.PubMedRefs {
+			doc["pubMedRefs"] = pubMedIDs(entity.pubMeds)
+		}
+		setCURIE(doc, entity.uri)
+		entity.fields.setOn(doc)
+
 		_, err := entityDB.UpdateOne(
-			context.TODO(),
+			ctx,
 			bson.M{"uri": entity.uri},
 			bson.M{"$set": doc},
 			updateOptions)
+		if interruptedWrite(ctx, err) {
+			return
+		}
 		if err != nil {
 			panic(err)
 		}
+		insertXrefsToDB(ctx, xrefDB, entity.uri, graph, doc["taxon"], entity.xrefs)
+		insertCitationsToDB(ctx, publicationDB, entity.uri, "entities", entity.pubMeds)
 		if entityNumber%10000 == 0 {
-			nowTime := time.Now().Unix()
-			duration := nowTime - timestamp
-			timestamp = nowTime
-			fmt.Printf("[%s][%s][T%d] Inserted entry %d in %d seconds\n", taxon, graph, index, entityNumber, duration)
-			// fmt.Println(taxon, "Thread", index, "Inserted", entityNumber, "into mongoDB graph", graph, "in", duration, "seconds")
+			logger.Info("Inserted documents", "count", entityNumber, "rate", meter.rate(entityNumber))
 		}
 	}
 }
 
+// cleanRDFString returns the value of a literal without quotes, language tag or datatype.
 func cleanRDFString(input string) string {
-	components := strings.Split(input, "^^")
-	value := strings.Replace(strings.Replace(strings.Replace(components[0], "\"", "", 2), " .", "", 1), "@en", "", 1)
-	return value
+	return parseLiteral(input).value
 }
 
 func generateEntityQuery(graph string, constraint string) string {
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Manifest is the build configuration. Everything has a default, so the builder runs without one.
+type Manifest struct {
+	// Taxa are the NCBI taxon IDs to build, as numbers or as NCBITaxon CURIEs or IRIs.
+	// With -discover, the taxa found in the uploads folder are built instead.
+	Taxa []string `json:"taxa"`
+	// GraphRoutes maps the graph labels of N-Quads (or of Virtuoso .graph files) to MetaDB collections.
+	// Graphs named http://rdf.biogateway.eu/graph/<collection> are routed to <collection> without an entry here.
+	GraphRoutes map[string]string `json:"graphRoutes"`
+	// Languages is the fallback chain used to pick prefLabel, lcLabel, definition and synonyms from language tagged literals.
+	// "en" also matches regional variants like "en-gb", "und" matches literals without a tag and "*" matches any language.
+	Languages []string `json:"languages"`
+	// LiteralFields maps predicate IRIs to extra document fields on entities and statements.
+	// The values are converted according to their XSD datatype, e.g. xsd:integer is stored as a number.
+	LiteralFields map[string]string `json:"literalFields"`
+	// Autocomplete sets the lengths of the word-start prefixes stored in the prefixes field for type-ahead search.
+	Autocomplete AutocompleteConfig `json:"autocomplete"`
+	// TextIndexes configures the $text index of each collection. The entry "*" is used for collections without their own.
+	TextIndexes map[string]TextIndexConfig `json:"textIndexes"`
+	// MergePolicy decides what happens to URIs found in more than one taxon file: "first", "merge" or "error".
+	MergePolicy string `json:"mergePolicy"`
+	// Ranking lists the rank components of each collection. Collections without components get no rank.
+	Ranking map[string][]RankComponent `json:"ranking"`
+	// XrefPredicates maps the predicate IRIs collected as cross-references to the kind of match stored in the xref collection.
+	XrefPredicates map[string]string `json:"xrefPredicates"`
+	// Prefixes maps CURIE prefixes to IRI namespaces, for the curie and localId fields and for xref namespaces.
+	// The IRIs of graphRoutes, literalFields and xrefPredicates can be given as CURIEs with these prefixes.
+	Prefixes map[string]string `json:"prefixes"`
+	// PubMedRefs adds the PubMed IDs cited by an entity to its document as pubMedRefs.
+	PubMedRefs bool `json:"pubMedRefs"`
+	// ValidationThresholds is the largest share (0 to 1) of the documents of a collection and taxon that may fail a
+	// validation check before the build fails. Checks without a threshold are only reported.
+	ValidationThresholds map[string]float64 `json:"validationThresholds"`
+}
+
+type AutocompleteConfig struct {
+	MinLength int `json:"minLength"`
+	MaxLength int `json:"maxLength"`
+}
+
+// TextIndexConfig is a weighted text index over several fields.
+// A collection whose config has no weights gets no text index.
+type TextIndexConfig struct {
+	Weights map[string]int32 `json:"weights"`
+	// DefaultLanguage is the language used for stemming and stop words. "none" indexes the words as they are,
+	// so gene symbols like "CAT" or "WAS" are neither stemmed nor dropped as stop words.
+	DefaultLanguage string `json:"defaultLanguage"`
+}
+
+// textIndexConfig returns the text index config for a collection.
+func (m Manifest) textIndexConfig(collection string) TextIndexConfig {
+	if config, ok := m.TextIndexes[collection]; ok {
+		return config
+	}
+	return m.TextIndexes["*"]
+}
+
+var manifest = defaultManifest()
+
+func defaultManifest() Manifest {
+	return Manifest{
+		Taxa: taxa,
+		GraphRoutes: map[string]string{
+			"http://rdf.biogateway.eu/graph/go": "goall",
+		},
+		Languages: []string{"en", untaggedLanguage},
+		Autocomplete: AutocompleteConfig{
+			MinLength: 1,
+			MaxLength: 20,
+		},
+		TextIndexes: map[string]TextIndexConfig{
+			"*": {
+				Weights:         map[string]int32{"prefLabel": 10, "synonyms": 5, "definition": 1},
+				DefaultLanguage: "none",
+			},
+			xrefCollection:        {},
+			publicationCollection: {},
+		},
+		MergePolicy: "first",
+		Ranking: map[string][]RankComponent{
+			"prot": {
+				{Scorer: "pubmed", Normalize: "log", Weight: 0.5},
+				{Scorer: "annotationScore", Normalize: "percentile", Weight: 0.25},
+				{Scorer: "degree", Normalize: "percentile", Weight: 0.25},
+			},
+			"gene": {
+				{Scorer: "refScore", Normalize: "log", Weight: 1},
+			},
+			"goall": {
+				{Scorer: "refScore", Normalize: "log", Weight: 1},
+			},
+			"omim": {
+				{Scorer: "refScore", Normalize: "log", Weight: 1},
+			},
+		},
+		XrefPredicates: map[string]string{
+			"http://www.w3.org/2004/02/skos/core#exactMatch":         "exact",
+			"http://www.w3.org/2004/02/skos/core#closeMatch":         "close",
+			"http://www.geneontology.org/formats/oboInOwl#hasDbXref": "xref",
+		},
+		Prefixes: map[string]string{
+			"UniProtKB": "http://uniprot.org/uniprot/",
+			"GO":        "http://purl.obolibrary.org/obo/GO_",
+			"NCBITaxon": "http://purl.obolibrary.org/obo/NCBITaxon_",
+			"RO":        "http://purl.obolibrary.org/obo/RO_",
+			"IAO":       "http://purl.obolibrary.org/obo/IAO_",
+			"OMIM":      "http://purl.bioontology.org/ontology/OMIM/",
+			"NCBIGene":  "http://identifiers.org/ncbigene/",
+			"ensembl":   "http://identifiers.org/ensembl/",
+			"pubmed":    "http://identifiers.org/pubmed/",
+			"intact":    "http://identifiers.org/intact/",
+			"mint":      "http://identifiers.org/mint/",
+			"biogrid":   "http://identifiers.org/biogrid/",
+			"reactome":  "http://identifiers.org/reactome/",
+			"signor":    "http://identifiers.org/signor/",
+			"bgw.gene":  "http://rdf.biogateway.eu/gene/",
+			"bgw":       "http://rdf.biogateway.eu/",
+			"rdf":       "http://www.w3.org/1999/02/22-rdf-syntax-ns#",
+			"rdfs":      "http://www.w3.org/2000/01/rdf-schema#",
+			"owl":       "http://www.w3.org/2002/07/owl#",
+			"xsd":       xsdNamespace,
+			"skos":      "http://www.w3.org/2004/02/skos/core#",
+			"oboInOwl":  "http://www.geneontology.org/formats/oboInOwl#",
+			"dcterms":   "http://purl.org/dc/terms/",
+			"schema":    "http://schema.org/",
+			"sio":       "http://semanticscience.org/resource/",
+		},
+		// Validation only reports unless the manifest sets thresholds.
+		ValidationThresholds: map[string]float64{},
+	}
+}
+
+// loadManifest reads a JSON manifest on top of the defaults.
+func loadManifest(path string) (Manifest, error) {
+	loaded := defaultManifest()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return loaded, err
+	}
+	if err := json.Unmarshal(content, &loaded); err != nil {
+		return loaded, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	if loaded.Autocomplete.MinLength < 1 || loaded.Autocomplete.MaxLength < loaded.Autocomplete.MinLength {
+		return loaded, fmt.Errorf("invalid manifest %s: autocomplete lengths must be 1 <= minLength <= maxLength", path)
+	}
+	for i, taxon := range loaded.Taxa {
+		// The input files are named by the numeric ID.
+		id := strings.TrimPrefix(loaded.expandCURIE(taxon), loaded.expandCURIE("NCBITaxon:"))
+		if id == "" || strings.Trim(id, "0123456789") != "" {
+			return loaded, fmt.Errorf("invalid manifest %s: taxon %q is not an NCBI taxon ID", path, taxon)
+		}
+		loaded.Taxa[i] = id
+	}
+	loaded.GraphRoutes = loaded.expandKeys(loaded.GraphRoutes)
+	loaded.LiteralFields = loaded.expandKeys(loaded.LiteralFields)
+	loaded.XrefPredicates = loaded.expandKeys(loaded.XrefPredicates)
+
+	validPolicy := false
+	for _, policy := range mergePolicies {
+		validPolicy = validPolicy || loaded.MergePolicy == policy
+	}
+	if !validPolicy {
+		return loaded, fmt.Errorf("invalid manifest %s: unknown mergePolicy %q", path, loaded.MergePolicy)
+	}
+	for check, threshold := range loaded.ValidationThresholds {
+		if threshold < 0 || threshold > 1 {
+			return loaded, fmt.Errorf("invalid manifest %s: the threshold of %s must be between 0 and 1", path, check)
+		}
+	}
+	for collection, components := range loaded.Ranking {
+		// rankComponents is keyed by scorer, so a scorer can only be used once per collection.
+		used := make(map[string]bool)
+		for _, component := range components {
+			if _, ok := scorers[component.Scorer]; !ok {
+				return loaded, fmt.Errorf("invalid manifest %s: unknown scorer %q in the ranking of %s", path, component.Scorer, collection)
+			}
+			if used[component.Scorer] {
+				return loaded, fmt.Errorf("invalid manifest %s: scorer %q is used twice in the ranking of %s", path, component.Scorer, collection)
+			}
+			used[component.Scorer] = true
+			validNormalization := component.Normalize == ""
+			for _, normalization := range normalizations {
+				validNormalization = validNormalization || component.Normalize == normalization
+			}
+			if !validNormalization {
+				return loaded, fmt.Errorf("invalid manifest %s: unknown normalization %q in the ranking of %s", path, component.Normalize, collection)
+			}
+		}
+	}
+	return loaded, nil
+}
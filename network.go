@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// computeCentrality enables the centrality pass over the interaction network.
+var computeCentrality = false
+
+var pageRankDamping = 0.85
+var pageRankIterations = 100
+var pageRankTolerance = 1e-10
+
+// interactionNetwork is the undirected interaction graph of one taxon, with the proteins numbered from 0.
+type interactionNetwork struct {
+	uris      []string
+	ids       map[string]int
+	neighbors []map[int]bool
+}
+
+func newInteractionNetwork() *interactionNetwork {
+	return &interactionNetwork{ids: make(map[string]int)}
+}
+
+func (n *interactionNetwork) node(uri string) int {
+	if id, ok := n.ids[uri]; ok {
+		return id
+	}
+	id := len(n.uris)
+	n.ids[uri] = id
+	n.uris = append(n.uris, uri)
+	n.neighbors = append(n.neighbors, make(map[int]bool))
+	return id
+}
+
+func (n *interactionNetwork) addInteraction(subject string, object string) {
+	from := n.node(subject)
+	to := n.node(object)
+	if from == to {
+		return
+	}
+	n.neighbors[from][to] = true
+	n.neighbors[to][from] = true
+}
+
+// pageRank computes the PageRank of every protein, summing to 1 over the network.
+// Proteins without interactions spread their rank evenly over all proteins.
+func (n *interactionNetwork) pageRank() []float64 {
+	count := len(n.uris)
+	ranks := make([]float64, count)
+	for i := range ranks {
+		ranks[i] = 1 / float64(count)
+	}
+	for iteration := 0; iteration < pageRankIterations; iteration++ {
+		next := make([]float64, count)
+		dangling := 0.0
+		for i, rank := range ranks {
+			if len(n.neighbors[i]) == 0 {
+				dangling += rank
+				continue
+			}
+			share := rank / float64(len(n.neighbors[i]))
+			for neighbor := range n.neighbors[i] {
+				next[neighbor] += share
+			}
+		}
+		base := (1-pageRankDamping)/float64(count) + pageRankDamping*dangling/float64(count)
+		change := 0.0
+		for i := range next {
+			next[i] = base + pageRankDamping*next[i]
+			change += math.Abs(next[i] - ranks[i])
+		}
+		ranks = next
+		if change < pageRankTolerance {
+			break
+		}
+	}
+	return ranks
+}
+
+// computeInteractionCentrality reads the prot2prot statements, and stores the degree (the number of distinct
+// interaction partners) and the PageRank within the taxon's interaction network on the protein documents.
+func computeInteractionCentrality(ctx context.Context, client *mongo.Client) {
+	db := client.Database("metadb")
+	cursor, err := db.Collection("prot2prot").Find(ctx, bson.M{},
+		options.Find().SetProjection(bson.M{"_id": 0, "subject": 1, "object": 1, "taxon": 1}))
+	if err != nil {
+		panic(err)
+	}
+	networks := make(map[string]*interactionNetwork)
+	for cursor.Next(ctx) {
+		var statement struct {
+			Subject string      `bson:"subject"`
+			Object  string      `bson:"object"`
+			Taxon   interface{} `bson:"taxon"`
+		}
+		if err := cursor.Decode(&statement); err != nil {
+			panic(err)
+		}
+		if statement.Subject == "" || statement.Object == "" {
+			continue
+		}
+		taxon := firstTaxon(statement.Taxon)
+		if networks[taxon] == nil {
+			networks[taxon] = newInteractionNetwork()
+		}
+		networks[taxon].addInteraction(statement.Subject, statement.Object)
+	}
+	if err := cursor.Err(); err != nil {
+		panic(err)
+	}
+	cursor.Close(ctx)
+
+	taxa := make([]string, 0, len(networks))
+	for taxon := range networks {
+		taxa = append(taxa, taxon)
+	}
+	sort.Strings(taxa)
+	// The scores by protein and taxon, a protein merged from several taxa can be in several networks.
+	scores := make(map[string]map[string]bson.M)
+	for _, taxon := range taxa {
+		network := networks[taxon]
+		ranks := network.pageRank()
+		for i, uri := range network.uris {
+			if scores[uri] == nil {
+				scores[uri] = make(map[string]bson.M)
+			}
+			scores[uri][taxon] = bson.M{"interactionDegree": len(network.neighbors[i]), "pageRank": ranks[i]}
+		}
+		slog.Info("Computed the centrality of the proteins", "phase", "centrality", "graph", "prot2prot", "taxon", taxon, "count", len(network.uris))
+	}
+
+	// Every taxon's scores are kept in centrality, by taxon ID. The flat fields, which the ranking uses, hold the
+	// scores in the network of the protein's first taxon.
+	updates := make(map[string]bson.M, len(scores))
+	shared := []string{}
+	for uri, byTaxon := range scores {
+		if len(byTaxon) > 1 {
+			shared = append(shared, uri)
+		}
+	}
+	proteinTaxa, err := firstTaxa(ctx, db.Collection("prot"), shared)
+	if err != nil {
+		panic(err)
+	}
+	for uri, byTaxon := range scores {
+		centrality := bson.M{}
+		for taxon, score := range byTaxon {
+			centrality[strings.TrimPrefix(taxon, taxonPrefix)] = score
+		}
+		update := bson.M{"centrality": centrality}
+		for field, value := range firstTaxonScore(byTaxon, proteinTaxa[uri]) {
+			update[field] = value
+		}
+		updates[uri] = update
+	}
+	if err := updateByURI(ctx, db.Collection("prot"), updates); err != nil {
+		panic(err)
+	}
+}
+
+// firstTaxonScore returns the scores of a protein in the network of its first taxon, the taxon the ranking's
+// percentiles group it by, or else in the first network by taxon.
+func firstTaxonScore(byTaxon map[string]bson.M, taxon string) bson.M {
+	if score, ok := byTaxon[taxon]; ok {
+		return score
+	}
+	taxa := make([]string, 0, len(byTaxon))
+	for t := range byTaxon {
+		taxa = append(taxa, t)
+	}
+	sort.Strings(taxa)
+	return byTaxon[taxa[0]]
+}
+
+// firstTaxa returns the first taxon of the documents of a collection with the given URIs, in batches of
+// copyBatchSize URIs to keep the queries small.
+func firstTaxa(ctx context.Context, collection *mongo.Collection, uris []string) (map[string]string, error) {
+	taxa := make(map[string]string, len(uris))
+	for start := 0; start < len(uris); start += copyBatchSize {
+		end := start + copyBatchSize
+		if end > len(uris) {
+			end = len(uris)
+		}
+		cursor, err := collection.Find(ctx, bson.M{"uri": bson.M{"$in": uris[start:end]}},
+			options.Find().SetProjection(bson.M{"_id": 0, "uri": 1, "taxon": 1}))
+		if err != nil {
+			return nil, err
+		}
+		for cursor.Next(ctx) {
+			var doc struct {
+				URI   string      `bson:"uri"`
+				Taxon interface{} `bson:"taxon"`
+			}
+			if err := cursor.Decode(&doc); err != nil {
+				cursor.Close(ctx)
+				return nil, err
+			}
+			taxa[doc.URI] = firstTaxon(doc.Taxon)
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return taxa, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// greekLetterNames spells out Greek letters, so "TNF-α" and "tnf-alpha" normalize to the same text.
+var greekLetterNames = map[rune]string{
+	'α': "alpha", 'β': "beta", 'γ': "gamma", 'δ': "delta", 'ε': "epsilon", 'ζ': "zeta",
+	'η': "eta", 'θ': "theta", 'ι': "iota", 'κ': "kappa", 'λ': "lambda", 'μ': "mu",
+	'ν': "nu", 'ξ': "xi", 'ο': "omicron", 'π': "pi", 'ρ': "rho", 'σ': "sigma", 'ς': "sigma",
+	'τ': "tau", 'υ': "upsilon", 'φ': "phi", 'ϕ': "phi", 'χ': "chi", 'ψ': "psi", 'ω': "omega",
+}
+
+// isSeparator is true for the runes that are collapsed into a single space: whitespace and all kinds of hyphens and dashes.
+func isSeparator(r rune) bool {
+	return unicode.IsSpace(r) || unicode.Is(unicode.Pd, r) || r == '_' || r == '−'
+}
+
+// normalizeSearchText normalizes a label or synonym for case and diacritic insensitive matching:
+// Unicode NFKC, case folding, diacritics removed, Greek letters spelled out and
+// runs of hyphens and whitespace collapsed into a single space.
+// The transformers are created per call, since they are not safe for concurrent use.
+func normalizeSearchText(value string) string {
+	folded := cases.Fold().String(norm.NFKC.String(value))
+	stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), folded)
+	if err != nil {
+		stripped = folded
+	}
+
+	var b strings.Builder
+	pendingSpace := false
+	for _, r := range stripped {
+		if isSeparator(r) {
+			pendingSpace = b.Len() > 0
+			continue
+		}
+		if pendingSpace {
+			b.WriteByte(' ')
+			pendingSpace = false
+		}
+		if name, ok := greekLetterNames[r]; ok {
+			b.WriteString(name)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// normalizeSearchTexts normalizes a list of values, leaving out duplicates and empty values.
+func normalizeSearchTexts(values []string) []string {
+	normalized := []string{}
+	seen := make(map[string]bool)
+	for _, value := range values {
+		if n := normalizeSearchText(value); n != "" && !seen[n] {
+			normalized = append(normalized, n)
+			seen[n] = true
+		}
+	}
+	return normalized
+}
+
+// searchTokens splits normalized labels and synonyms into distinct word tokens,
+// and returns the word-start prefixes (edge n-grams) of those tokens for type-ahead lookups.
+// Prefixes are between manifest.Autocomplete.MinLength and MaxLength characters long; longer tokens are only
+// found by their prefixes up to MaxLength, or by the full token in tokens.
+func searchTokens(values []string) (tokens []string, prefixes []string) {
+	tokens = []string{}
+	prefixes = []string{}
+	seenTokens := make(map[string]bool)
+	seenPrefixes := make(map[string]bool)
+	for _, value := range values {
+		words := strings.FieldsFunc(normalizeSearchText(value), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			if seenTokens[word] {
+				continue
+			}
+			seenTokens[word] = true
+			tokens = append(tokens, word)
+
+			runes := []rune(word)
+			for length := manifest.Autocomplete.MinLength; length <= len(runes) && length <= manifest.Autocomplete.MaxLength; length++ {
+				prefix := string(runes[:length])
+				if !seenPrefixes[prefix] {
+					seenPrefixes[prefix] = true
+					prefixes = append(prefixes, prefix)
+				}
+			}
+		}
+	}
+	return tokens, prefixes
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+var oboNamespace = "http://purl.obolibrary.org/obo/"
+
+var oboDefinitionRT = "<http://purl.obolibrary.org/obo/IAO_0000115>"
+var subClassOfRT = "<http://www.w3.org/2000/01/rdf-schema#subClassOf>"
+var deprecatedRT = "<http://www.w3.org/2002/07/owl#deprecated>"
+var dbXrefRT = "<http://www.geneontology.org/formats/oboInOwl#hasDbXref>"
+var oboNamespaceRT = "<http://www.geneontology.org/formats/oboInOwl#hasOBONamespace>"
+
+// oboSynonymRTs are the oboInOwl synonym predicates, keyed by the OBO synonym scope.
+var oboSynonymRTs = map[string]string{
+	"EXACT":   "<http://www.geneontology.org/formats/oboInOwl#hasExactSynonym>",
+	"RELATED": "<http://www.geneontology.org/formats/oboInOwl#hasRelatedSynonym>",
+	"BROAD":   "<http://www.geneontology.org/formats/oboInOwl#hasBroadSynonym>",
+	"NARROW":  "<http://www.geneontology.org/formats/oboInOwl#hasNarrowSynonym>",
+}
+
+// isSynonymRT is true for the predicates that give an alternative name for an entity.
+func isSynonymRT(predicate string) bool {
+	if predicate == synonymRT {
+		return true
+	}
+	for _, rt := range oboSynonymRTs {
+		if predicate == rt {
+			return true
+		}
+	}
+	return false
+}
+
+// functionalScanner is a streaming reader for OWL functional syntax. It parses one axiom at a time,
+// so axioms may span several lines, and returns the class declarations, annotation assertions and
+// named superclasses as triples. The other axioms are not needed for the MetaDB and are skipped.
+type functionalScanner struct {
+	reader   *bufio.Reader
+	name     string
+	line     int
+	prefixes map[string]string
+	peeked   *functionalToken
+	pending  []Triple
+	triple   Triple
+	done     bool
+	err      error
+}
+
+// functionalExpression is an axiom or one of its arguments: either a named expression
+// like SubClassOf(...) with its arguments, or a single IRI, name or literal.
+type functionalExpression struct {
+	name     string
+	args     []functionalExpression
+	token    functionalToken
+	compound bool
+}
+
+type functionalTokenKind int
+
+const (
+	funcEOF functionalTokenKind = iota
+	funcOpen
+	funcClose
+	funcIRI
+	funcName
+	funcLiteral
+)
+
+type functionalToken struct {
+	kind     functionalTokenKind
+	text     string
+	lang     string
+	datatype *functionalToken
+}
+
+func newFunctionalScanner(r *bufio.Reader, name string) *functionalScanner {
+	return &functionalScanner{
+		reader: r,
+		name:   name,
+		line:   1,
+		// The prefixes every OWL functional syntax document may use without declaring them.
+		prefixes: map[string]string{
+			"rdf:":  rdfNamespace,
+			"rdfs:": "http://www.w3.org/2000/01/rdf-schema#",
+			"xsd:":  xsdNamespace,
+			"owl:":  "http://www.w3.org/2002/07/owl#",
+		},
+	}
+}
+
+func (s *functionalScanner) Scan() bool {
+	for len(s.pending) == 0 {
+		if s.done {
+			return false
+		}
+		if err := s.statement(); err != nil {
+			// Triples parsed before an error are still handed out.
+			s.done = true
+			if err != io.EOF {
+				s.err = fmt.Errorf("%s line %d: %w", s.name, s.line, err)
+			}
+		}
+	}
+	s.triple = s.pending[0]
+	s.pending = s.pending[1:]
+	return true
+}
+
+func (s *functionalScanner) Triple() Triple {
+	return s.triple
+}
+
+func (s *functionalScanner) Line() int {
+	return s.line
+}
+
+func (s *functionalScanner) Err() error {
+	return s.err
+}
+
+func (s *functionalScanner) Close() error {
+	return nil
+}
+
+// statement reads the next top-level item. Ontology( is only opened, so the axioms
+// inside it are read one by one instead of as a single expression.
+func (s *functionalScanner) statement() error {
+	tok, err := s.next()
+	if err != nil {
+		return err
+	}
+	switch tok.kind {
+	case funcEOF:
+		return io.EOF
+	case funcName:
+		open, err := s.next()
+		if err != nil {
+			return err
+		}
+		if open.kind != funcOpen {
+			return fmt.Errorf("expected ( after %s", tok.text)
+		}
+		if tok.text == "Ontology" {
+			return nil
+		}
+		expression, err := s.expression(tok.text)
+		if err != nil {
+			return err
+		}
+		return s.axiom(expression)
+	}
+	// The ontology and version IRIs, and the parenthesis that closes the ontology.
+	return nil
+}
+
+// expression reads the arguments of a named expression whose opening parenthesis was read.
+func (s *functionalScanner) expression(name string) (functionalExpression, error) {
+	expression := functionalExpression{name: name, compound: true}
+	for {
+		tok, err := s.next()
+		if err != nil {
+			return expression, err
+		}
+		switch tok.kind {
+		case funcEOF:
+			return expression, fmt.Errorf("unexpected end of file in %s(", name)
+		case funcClose:
+			return expression, nil
+		case funcOpen:
+			return expression, fmt.Errorf("unexpected ( in %s(", name)
+		case funcName:
+			open, err := s.next()
+			if err != nil {
+				return expression, err
+			}
+			if open.kind == funcOpen {
+				arg, err := s.expression(tok.text)
+				if err != nil {
+					return expression, err
+				}
+				expression.args = append(expression.args, arg)
+				continue
+			}
+			s.peeked = &open
+		}
+		expression.args = append(expression.args, functionalExpression{token: tok})
+	}
+}
+
+// axiom converts the axioms that are loaded to triples.
+func (s *functionalScanner) axiom(expression functionalExpression) error {
+	args := withoutAnnotations(expression.args)
+	switch expression.name {
+	case "Prefix":
+		if len(args) == 3 && args[0].token.kind == funcName && args[2].token.kind == funcIRI {
+			s.prefixes[args[0].token.text] = args[2].token.text
+			return nil
+		}
+		return fmt.Errorf("malformed prefix declaration")
+	case "Declaration":
+		if len(args) == 1 && args[0].name == "Class" && len(args[0].args) == 1 {
+			class, err := s.term(args[0].args[0])
+			if err != nil {
+				return err
+			}
+			s.emit(class, typeRT, classURI)
+		}
+	case "AnnotationAssertion":
+		if len(args) != 3 {
+			return fmt.Errorf("expected property, subject and value in AnnotationAssertion")
+		}
+		terms := make([]string, 3)
+		for i, arg := range args {
+			term, err := s.term(arg)
+			if err != nil {
+				return err
+			}
+			terms[i] = term
+		}
+		s.emit(terms[1], terms[0], terms[2])
+	case "SubClassOf":
+		// Only named superclasses, restrictions are not part of the class hierarchy.
+		if len(args) == 2 && !args[0].compound && !args[1].compound {
+			sub, err := s.term(args[0])
+			if err != nil {
+				return err
+			}
+			super, err := s.term(args[1])
+			if err != nil {
+				return err
+			}
+			s.emit(sub, subClassOfRT, super)
+		}
+	}
+	return nil
+}
+
+// withoutAnnotations drops the Annotation(...) arguments that annotate an axiom.
+func withoutAnnotations(args []functionalExpression) []functionalExpression {
+	kept := make([]functionalExpression, 0, len(args))
+	for _, arg := range args {
+		if arg.name != "Annotation" {
+			kept = append(kept, arg)
+		}
+	}
+	return kept
+}
+
+// term returns the N-Triples form of an IRI, abbreviated IRI, blank node or literal.
+func (s *functionalScanner) term(expression functionalExpression) (string, error) {
+	if expression.compound {
+		return "", fmt.Errorf("expected IRI or literal, found %s(", expression.name)
+	}
+	tok := expression.token
+	switch tok.kind {
+	case funcIRI:
+		return "<" + tok.text + ">", nil
+	case funcName:
+		if strings.HasPrefix(tok.text, "_:") {
+			return tok.text, nil
+		}
+		iri, err := s.expand(tok.text)
+		if err != nil {
+			return "", err
+		}
+		return "<" + iri + ">", nil
+	case funcLiteral:
+		literal := "\"" + escapeNTriplesString(tok.text) + "\""
+		if tok.lang != "" {
+			return literal + "@" + tok.lang, nil
+		}
+		if tok.datatype != nil {
+			datatype, err := s.term(functionalExpression{token: *tok.datatype})
+			if err != nil {
+				return "", err
+			}
+			if datatype != "<"+xsdNamespace+"string>" {
+				return literal + "^^" + datatype, nil
+			}
+		}
+		return literal, nil
+	}
+	return "", fmt.Errorf("expected IRI or literal, found %q", tok.text)
+}
+
+// expand resolves an abbreviated IRI like obo:GO_0008150 with the declared prefixes.
+func (s *functionalScanner) expand(name string) (string, error) {
+	index := strings.Index(name, ":")
+	if index < 0 {
+		return "", fmt.Errorf("expected IRI, found %q", name)
+	}
+	namespace, ok := s.prefixes[name[:index+1]]
+	if !ok {
+		return "", fmt.Errorf("undeclared prefix %s", name[:index+1])
+	}
+	return namespace + name[index+1:], nil
+}
+
+func (s *functionalScanner) emit(subject string, predicate string, object string) {
+	s.pending = append(s.pending, Triple{subject: subject, predicate: predicate, object: object})
+}
+
+func (s *functionalScanner) next() (functionalToken, error) {
+	if s.peeked != nil {
+		tok := *s.peeked
+		s.peeked = nil
+		return tok, nil
+	}
+	return s.lex()
+}
+
+func (s *functionalScanner) readRune() (rune, error) {
+	r, _, err := s.reader.ReadRune()
+	if err == nil && r == '\n' {
+		s.line++
+	}
+	return r, err
+}
+
+func (s *functionalScanner) unreadRune(r rune) {
+	if r == '\n' {
+		s.line--
+	}
+	s.reader.UnreadRune()
+}
+
+// lex reads the next token, skipping whitespace and comments.
+func (s *functionalScanner) lex() (functionalToken, error) {
+	var r rune
+	var err error
+	for {
+		r, err = s.readRune()
+		if err == io.EOF {
+			return functionalToken{kind: funcEOF}, nil
+		}
+		if err != nil {
+			return functionalToken{}, err
+		}
+		if r == '#' {
+			for r != '\n' && err == nil {
+				r, err = s.readRune()
+			}
+			continue
+		}
+		if !unicode.IsSpace(r) {
+			break
+		}
+	}
+
+	switch r {
+	case '(':
+		return functionalToken{kind: funcOpen, text: "("}, nil
+	case ')':
+		return functionalToken{kind: funcClose, text: ")"}, nil
+	case '=':
+		return functionalToken{kind: funcName, text: "="}, nil
+	case '<':
+		iri, err := s.reader.ReadString('>')
+		if err != nil {
+			return functionalToken{}, fmt.Errorf("unterminated IRI")
+		}
+		s.line += strings.Count(iri, "\n")
+		return functionalToken{kind: funcIRI, text: iri[:len(iri)-1]}, nil
+	case '"':
+		return s.readLiteral()
+	}
+	s.unreadRune(r)
+	return functionalToken{kind: funcName, text: s.readName()}, nil
+}
+
+// readName reads an abbreviated IRI, a blank node label or a keyword.
+func (s *functionalScanner) readName() string {
+	var b strings.Builder
+	for {
+		r, err := s.readRune()
+		if err != nil {
+			return b.String()
+		}
+		if unicode.IsSpace(r) || strings.ContainsRune("()<>\"=#", r) {
+			s.unreadRune(r)
+			return b.String()
+		}
+		b.WriteRune(r)
+	}
+}
+
+// readLiteral reads a quoted string, whose only escapes are \" and \\, and its language tag or datatype.
+func (s *functionalScanner) readLiteral() (functionalToken, error) {
+	var b strings.Builder
+	for {
+		r, err := s.readRune()
+		if err != nil {
+			return functionalToken{}, fmt.Errorf("unterminated string")
+		}
+		if r == '"' {
+			break
+		}
+		if r == '\\' {
+			if r, err = s.readRune(); err != nil {
+				return functionalToken{}, fmt.Errorf("unterminated string")
+			}
+		}
+		b.WriteRune(r)
+	}
+	tok := functionalToken{kind: funcLiteral, text: b.String()}
+	next, err := s.reader.Peek(2)
+	switch {
+	case len(next) > 0 && next[0] == '@':
+		s.readRune()
+		tok.lang = s.readName()
+	case err == nil && string(next) == "^^":
+		s.readRune()
+		s.readRune()
+		datatype, err := s.lex()
+		if err != nil {
+			return tok, err
+		}
+		if datatype.kind != funcIRI && datatype.kind != funcName {
+			return tok, fmt.Errorf("expected datatype after ^^")
+		}
+		tok.datatype = &datatype
+	}
+	return tok, nil
+}
+
+// oboScanner reads OBO flat files line by line. Only [Term] stanzas are converted to triples,
+// using the same predicates as the OWL translation of OBO, so both can be parsed the same way.
+type oboScanner struct {
+	lines    *bufio.Scanner
+	line     int
+	idSpaces map[string]string
+	stanza   string
+	subject  string
+	pending  []Triple
+	triple   Triple
+}
+
+func newOBOScanner(r io.Reader) *oboScanner {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 64*1024), maxLineSize)
+	return &oboScanner{lines: lines, idSpaces: make(map[string]string)}
+}
+
+func (s *oboScanner) Scan() bool {
+	for len(s.pending) == 0 {
+		if !s.lines.Scan() {
+			return false
+		}
+		s.line++
+		s.readLine(strings.TrimSpace(s.lines.Text()))
+	}
+	s.triple = s.pending[0]
+	s.pending = s.pending[1:]
+	return true
+}
+
+func (s *oboScanner) Triple() Triple {
+	return s.triple
+}
+
+func (s *oboScanner) Line() int {
+	return s.line
+}
+
+func (s *oboScanner) Err() error {
+	return s.lines.Err()
+}
+
+func (s *oboScanner) Close() error {
+	return nil
+}
+
+func (s *oboScanner) readLine(line string) {
+	if line == "" || strings.HasPrefix(line, "!") {
+		return
+	}
+	if strings.HasPrefix(line, "[") {
+		s.stanza = line
+		s.subject = ""
+		return
+	}
+	tag, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return
+	}
+	value = strings.TrimSpace(value)
+
+	if s.stanza == "" {
+		if tag == "idspace" {
+			if fields := strings.Fields(value); len(fields) >= 2 {
+				s.idSpaces[fields[0]] = fields[1]
+			}
+		}
+		return
+	}
+	if s.stanza != "[Term]" {
+		return
+	}
+	if tag == "id" {
+		s.subject = "<" + s.oboIDToIRI(value) + ">"
+		s.emit(typeRT, classURI)
+		return
+	}
+	if s.subject == "" {
+		return
+	}
+
+	switch tag {
+	case "name":
+		s.emit(labelRT, oboLiteral(value))
+	case "def":
+		text, _ := oboQuotedString(value)
+		s.emit(oboDefinitionRT, oboLiteral(text))
+	case "synonym":
+		text, rest := oboQuotedString(value)
+		scope := "RELATED"
+		if fields := strings.Fields(rest); len(fields) > 0 {
+			if _, ok := oboSynonymRTs[fields[0]]; ok {
+				scope = fields[0]
+			}
+		}
+		s.emit(oboSynonymRTs[scope], oboLiteral(text))
+	case "is_a":
+		s.emit(subClassOfRT, "<"+s.oboIDToIRI(oboStripComment(value))+">")
+	case "is_obsolete":
+		if oboStripComment(value) == "true" {
+			s.emit(deprecatedRT, "\"true\"^^<"+xsdNamespace+"boolean>")
+		}
+	case "xref":
+		if fields := strings.Fields(oboStripComment(value)); len(fields) > 0 {
+			s.emit(dbXrefRT, oboLiteral(fields[0]))
+		}
+	case "namespace":
+		s.emit(oboNamespaceRT, oboLiteral(oboStripComment(value)))
+	}
+}
+
+func (s *oboScanner) emit(predicate string, object string) {
+	s.pending = append(s.pending, Triple{subject: s.subject, predicate: predicate, object: object})
+}
+
+// oboIDToIRI expands an OBO identifier like GO:0008150 to its OBO PURL, or to the IRI declared by an idspace header.
+func (s *oboScanner) oboIDToIRI(id string) string {
+	if strings.Contains(id, "://") {
+		return id
+	}
+	prefix, local, ok := strings.Cut(id, ":")
+	if !ok {
+		return oboNamespace + id
+	}
+	if namespace, ok := s.idSpaces[prefix]; ok {
+		return namespace + local
+	}
+	return oboNamespace + prefix + "_" + local
+}
+
+// oboQuotedString returns the contents of the quoted string at the start of value, and what follows it.
+func oboQuotedString(value string) (string, string) {
+	if !strings.HasPrefix(value, "\"") {
+		return oboStripComment(value), ""
+	}
+	var b strings.Builder
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if i+1 < len(value) {
+				i++
+				if value[i] == 'n' {
+					b.WriteByte('\n')
+				} else {
+					b.WriteByte(value[i])
+				}
+			}
+		case '"':
+			return b.String(), strings.TrimSpace(value[i+1:])
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String(), ""
+}
+
+// oboStripComment removes trailing qualifiers {...} and comments (! ...) from a tag value.
+func oboStripComment(value string) string {
+	if index := strings.Index(value, " !"); index >= 0 {
+		value = value[:index]
+	}
+	if index := strings.Index(value, " {"); index >= 0 {
+		value = value[:index]
+	}
+	return strings.TrimSpace(value)
+}
+
+func oboLiteral(value string) string {
+	return "\"" + escapeNTriplesString(value) + "\""
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testRDFS = "http://www.w3.org/2000/01/rdf-schema#"
+	testOBO  = "http://purl.obolibrary.org/obo/"
+)
+
+// scanTriples returns the triples of a scanner as "subject predicate object" lines, and the scanner's error.
+func scanTriples(scanner TripleScanner) ([]string, error) {
+	triples := []string{}
+	for scanner.Scan() {
+		triple := scanner.Triple()
+		triples = append(triples, triple.subject+" "+triple.predicate+" "+triple.object)
+	}
+	return triples, scanner.Err()
+}
+
+func TestFunctionalScanner(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		triples []string
+	}{
+		{
+			name: "declarations and labels",
+			input: `Prefix(obo:=<http://purl.obolibrary.org/obo/>)
+Ontology(<http://purl.obolibrary.org/obo/go.owl>
+Declaration(Class(obo:GO_0008150))
+AnnotationAssertion(rdfs:label obo:GO_0008150 "biological_process"@en)
+)`,
+			triples: []string{
+				"<" + testOBO + "GO_0008150> <" + testRDF + "type> <http://www.w3.org/2002/07/owl#Class>",
+				"<" + testOBO + "GO_0008150> <" + testRDFS + "label> \"biological_process\"@en",
+			},
+		},
+		{
+			name: "multi-line axioms",
+			input: `Prefix(obo:=<http://purl.obolibrary.org/obo/>)
+Ontology(
+AnnotationAssertion(
+    Annotation(<http://www.geneontology.org/formats/oboInOwl#hasDbXref> "GOC:go_curators")
+    obo:IAO_0000115
+    obo:GO_0008150
+    "A biological process.
+Spans two lines."^^xsd:string)
+SubClassOf(
+    obo:GO_0009987
+    obo:GO_0008150)
+)`,
+			triples: []string{
+				"<" + testOBO + "GO_0008150> <" + testOBO + "IAO_0000115> \"A biological process.\\nSpans two lines.\"",
+				"<" + testOBO + "GO_0009987> <" + testRDFS + "subClassOf> <" + testOBO + "GO_0008150>",
+			},
+		},
+		{
+			name: "escaped quotes and backslashes",
+			input: `Ontology(
+AnnotationAssertion(<http://ex.org/p> <http://ex.org/s> "say \"hi\" (or not) \\ bye")
+)`,
+			triples: []string{`<http://ex.org/s> <http://ex.org/p> "say \"hi\" (or not) \\ bye"`},
+		},
+		{
+			name: "typed literal",
+			input: `Ontology(
+AnnotationAssertion(owl:deprecated <http://ex.org/s> "true"^^xsd:boolean)
+)`,
+			triples: []string{"<http://ex.org/s> <http://www.w3.org/2002/07/owl#deprecated> \"true\"^^<" + testXSD + "boolean>"},
+		},
+		{
+			name: "restrictions and other axioms are skipped",
+			input: `Prefix(obo:=<http://purl.obolibrary.org/obo/>)
+Ontology(
+# A comment with a ( parenthesis
+SubClassOf(obo:GO_0009987 ObjectSomeValuesFrom(obo:BFO_0000050 obo:GO_0008150))
+EquivalentClasses(obo:GO_1 ObjectIntersectionOf(obo:GO_2 obo:GO_3))
+Declaration(ObjectProperty(obo:BFO_0000050))
+)`,
+			triples: []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scanner := newFunctionalScanner(bufio.NewReader(strings.NewReader(test.input)), "test.ofn")
+			triples, err := scanTriples(scanner)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(triples, test.triples) {
+				t.Errorf("got %q, want %q", triples, test.triples)
+			}
+		})
+	}
+}
+
+func TestFunctionalScannerErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "unterminated axiom", input: "Ontology(\nSubClassOf(<http://ex.org/a>\n"},
+		{name: "unterminated string", input: "Ontology(\nAnnotationAssertion(<http://ex.org/p> <http://ex.org/s> \"open)\n)"},
+		{name: "undeclared prefix", input: "Ontology(\nDeclaration(Class(ex:a))\n)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scanner := newFunctionalScanner(bufio.NewReader(strings.NewReader(test.input)), "test.ofn")
+			if _, err := scanTriples(scanner); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestOBOScanner(t *testing.T) {
+	input := `format-version: 1.2
+idspace: EX http://ex.org/
+
+[Term]
+id: GO:0008150
+name: biological_process
+def: "A \"biological\" process \\ with quotes." [GOC:go_curators]
+synonym: "physiological process" EXACT []
+is_a: GO:0003674 ! molecular_function
+xref: EX:1 {source="x"}
+
+[Typedef]
+id: part_of
+name: part of
+`
+	want := []string{
+		"<" + testOBO + "GO_0008150> <" + testRDF + "type> <http://www.w3.org/2002/07/owl#Class>",
+		"<" + testOBO + "GO_0008150> <" + testRDFS + "label> \"biological_process\"",
+		"<" + testOBO + "GO_0008150> <" + testOBO + "IAO_0000115> \"A \\\"biological\\\" process \\\\ with quotes.\"",
+		"<" + testOBO + "GO_0008150> <http://www.geneontology.org/formats/oboInOwl#hasExactSynonym> \"physiological process\"",
+		"<" + testOBO + "GO_0008150> <" + testRDFS + "subClassOf> <" + testOBO + "GO_0003674>",
+		"<" + testOBO + "GO_0008150> <http://www.geneontology.org/formats/oboInOwl#hasDbXref> \"EX:1\"",
+	}
+	triples, err := scanTriples(newOBOScanner(strings.NewReader(input)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(triples, want) {
+		t.Errorf("got %q, want %q", triples, want)
+	}
+}
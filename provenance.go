@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// buildVersion is the BioGateway version being built, given with -version.
+var buildVersion = ""
+
+// buildCollection holds the provenance record of the build, with the _id "build".
+var buildCollection = "_build"
+
+// InputFile is an input file read by the build.
+type InputFile struct {
+	Path       string `json:"path" bson:"path"`
+	Collection string `json:"collection" bson:"collection"`
+	Size       int64  `json:"size" bson:"size"`
+	SHA256     string `json:"sha256" bson:"sha256"`
+	Lines      int    `json:"lines" bson:"lines"`
+}
+
+// Phase is a timed step of the build.
+type Phase struct {
+	Name     string    `json:"name" bson:"name"`
+	Started  time.Time `json:"started" bson:"started"`
+	Finished time.Time `json:"finished" bson:"finished"`
+	Seconds  float64   `json:"seconds" bson:"seconds"`
+}
+
+// provenance collects the input files and phases of the build, for the _build record.
+var provenance = struct {
+	sync.Mutex
+	started time.Time
+	inputs  []InputFile
+	phases  []Phase
+}{started: time.Now().UTC()}
+
+func recordInput(input InputFile) {
+	provenance.Lock()
+	defer provenance.Unlock()
+	provenance.inputs = append(provenance.inputs, input)
+}
+
+// startPhase starts timing a phase of the build. The returned function ends it.
+func startPhase(name string) func() {
+	setCurrentStep(name)
+	started := time.Now().UTC()
+	return func() {
+		finished := time.Now().UTC()
+		provenance.Lock()
+		defer provenance.Unlock()
+		provenance.phases = append(provenance.phases, Phase{
+			Name:     name,
+			Started:  started,
+			Finished: finished,
+			Seconds:  finished.Sub(started).Seconds(),
+		})
+	}
+}
+
+// hashedFile is an input file that computes its SHA-256 checksum and size while it is read.
+type hashedFile struct {
+	ctx  context.Context
+	file *os.File
+	path string
+	hash hash.Hash
+	size int64
+}
+
+func openHashed(ctx context.Context, path string) (*hashedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &hashedFile{ctx: ctx, file: file, path: path, hash: sha256.New()}, nil
+}
+
+func (f *hashedFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	f.hash.Write(p[:n])
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *hashedFile) Close() error {
+	return f.file.Close()
+}
+
+// finish reads the rest of the file, so the checksum covers all of it, closes it and records it as an input
+// of the collection with the number of lines read. A file whose reading was interrupted is only closed.
+func (f *hashedFile) finish(collection string, lines int) error {
+	if f.ctx.Err() != nil {
+		return f.Close()
+	}
+	if _, err := io.Copy(io.Discard, f); err != nil {
+		f.Close()
+		return err
+	}
+	recordInput(InputFile{
+		Path:       f.path,
+		Collection: collection,
+		Size:       f.size,
+		SHA256:     hex.EncodeToString(f.hash.Sum(nil)),
+		Lines:      lines,
+	})
+	return f.Close()
+}
+
+// builderRevision returns the git revision the builder was compiled from, with "-dirty" if it had local changes.
+// It is only known for binaries built with go build inside the repository.
+func builderRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	revision := "unknown"
+	modified := false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// writeBuildRecord replaces the provenance record in the _build collection. status is "completed", "failed"
+// or "interrupted".
+func writeBuildRecord(ctx context.Context, client *mongo.Client, status string) {
+	provenance.Lock()
+	defer provenance.Unlock()
+	finished := time.Now().UTC()
+
+	// Stored as a document, so the MetaDB server can return it as is.
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		panic(err)
+	}
+	var manifestDoc bson.M
+	if err := bson.UnmarshalExtJSON(content, false, &manifestDoc); err != nil {
+		panic(err)
+	}
+	inputs := provenance.inputs
+	if inputs == nil {
+		inputs = []InputFile{}
+	}
+	phases := provenance.phases
+	if phases == nil {
+		phases = []Phase{}
+	}
+
+	units := []Checkpoint{}
+	cursor, err := client.Database("metadb").Collection(checkpointCollection).Find(ctx, bson.M{})
+	if err != nil {
+		panic(err)
+	}
+	if err := cursor.All(ctx, &units); err != nil {
+		panic(err)
+	}
+	previousVersion := ""
+	if previousBuild != nil {
+		previousVersion = previousBuild.version
+	}
+
+	doc := bson.M{
+		"version":         buildVersion,
+		"status":          status,
+		"started":         provenance.started,
+		"finished":        finished,
+		"durationSeconds": finished.Sub(provenance.started).Seconds(),
+		"builderRevision": builderRevision(),
+		"taxa":            taxa,
+		"threads":         threadCount,
+		"manifest":        manifestDoc,
+		"inputs":          inputs,
+		"units":           units,
+		"previousVersion": previousVersion,
+		"phases":          phases,
+	}
+	if status == "interrupted" {
+		doc["interruptedIn"] = getCurrentStep()
+	}
+	_, err = client.Database("metadb").Collection(buildCollection).ReplaceOne(
+		ctx,
+		bson.M{"_id": "build"},
+		doc,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		panic(err)
+	}
+	slog.Info("Recorded the build", "graph", buildCollection, "version", buildVersion, "status", status, "count", len(inputs))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// publicationCollection holds one document per PubMed ID, with the entities and statements citing it.
+var publicationCollection = "publication"
+
+// pubMedID returns the PubMed ID of a PubMed IRI, the digits it ends with, or the IRI itself if it has none.
+func pubMedID(uri string) string {
+	if id := trailingDigits(uri); id != "" {
+		return id
+	}
+	return uri
+}
+
+// pubMedIDs returns the distinct PubMed IDs of a list of PubMed IRIs.
+func pubMedIDs(uris []string) []string {
+	ids := []string{}
+	seen := make(map[string]bool)
+	for _, uri := range uris {
+		id := pubMedID(uri)
+		if !seen[id] {
+			ids = append(ids, id)
+			seen[id] = true
+		}
+	}
+	return ids
+}
+
+// insertCitationsToDB adds an entity or statement to the publications it cites.
+// field is "entities" or "statements".
+func insertCitationsToDB(ctx context.Context, publicationDB *mongo.Collection, uri string, field string, pubMeds []string) {
+	updateOptions := options.Update().SetUpsert(true)
+	seen := make(map[string]bool)
+	for _, pubMedURI := range pubMeds {
+		id := pubMedID(pubMedURI)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		set := bson.M{"pmid": id, "uri": pubMedURI}
+		setCURIE(set, pubMedURI)
+		_, err := publicationDB.UpdateOne(
+			ctx,
+			bson.M{"pmid": id},
+			bson.M{"$set": set, "$addToSet": bson.M{field: uri}},
+			updateOptions)
+		if interruptedWrite(ctx, err) {
+			return
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// countCitations sets entityCount and statementCount on every publication, once all citations are inserted.
+func countCitations(ctx context.Context, client *mongo.Client) {
+	publicationDB := client.Database("metadb").Collection(publicationCollection)
+	result, err := publicationDB.UpdateMany(ctx, bson.M{}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"entityCount":    bson.M{"$size": bson.M{"$ifNull": bson.A{"$entities", bson.A{}}}},
+			"statementCount": bson.M{"$size": bson.M{"$ifNull": bson.A{"$statements", bson.A{}}}},
+		}}},
+	})
+	if err != nil {
+		panic(err)
+	}
+	slog.Info("Counted the citations", "phase", "link", "graph", publicationCollection, "count", result.MatchedCount)
+
+	// Publications whose citations were all removed by clearUnit.
+	deleted, err := publicationDB.DeleteMany(ctx, bson.M{"entityCount": 0, "statementCount": 0})
+	if err != nil {
+		panic(err)
+	}
+	if deleted.DeletedCount > 0 {
+		slog.Info("Removed publications without citations", "phase", "link", "graph", publicationCollection, "count", deleted.DeletedCount)
+	}
+}
+
+// pullCitations removes entities and statements from the publications citing them.
+func pullCitations(ctx context.Context, db *mongo.Database, uris []string) {
+	publicationDB := db.Collection(publicationCollection)
+	for start := 0; start < len(uris); start += copyBatchSize {
+		end := start + copyBatchSize
+		if end > len(uris) {
+			end = len(uris)
+		}
+		batch := uris[start:end]
+		_, err := publicationDB.UpdateMany(
+			ctx,
+			bson.M{"$or": bson.A{bson.M{"entities": bson.M{"$in": batch}}, bson.M{"statements": bson.M{"$in": batch}}}},
+			bson.M{"$pull": bson.M{"entities": bson.M{"$in": batch}, "statements": bson.M{"$in": batch}}})
+		if err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RankComponent is one weighted term of a collection's rank: the raw score of a scorer, normalized and weighted.
+type RankComponent struct {
+	Scorer string `json:"scorer"`
+	// Normalize is "none", "log" (log(1+x) divided by the collection's maximum) or "percentile" (within the taxon).
+	Normalize string  `json:"normalize"`
+	Weight    float64 `json:"weight"`
+}
+
+// Scorer computes a raw score for the documents of a collection.
+type Scorer interface {
+	// Fields are the document fields Score needs.
+	Fields() []string
+	// Prepare is called once per collection before Score, for scorers that need other collections.
+	Prepare(ctx context.Context, db *mongo.Database, collection string) error
+	Score(doc bson.M) float64
+}
+
+// scorers are the scorers the manifest's ranking can refer to.
+var scorers = map[string]Scorer{
+	"pubmed":          &fieldScorer{field: "pubMedCount"},
+	"annotationScore": &fieldScorer{field: "annotationScore"},
+	"refScore":        &fieldScorer{field: "refScore"},
+	"degree":          &degreeScorer{statements: "prot2prot"},
+	// Set by the centrality pass (-centrality).
+	"interactionDegree": &fieldScorer{field: "interactionDegree"},
+	"pageRank":          &fieldScorer{field: "pageRank"},
+	// Set by the linking pass.
+	"goAnnotationCount": &fieldScorer{field: "goAnnotationCount"},
+	"phenotypeCount":    &fieldScorer{field: "phenotypeCount"},
+}
+
+var normalizations = []string{"none", "log", "percentile"}
+
+// fieldScorer uses a numeric field of the document as it is.
+type fieldScorer struct {
+	field string
+}
+
+func (s *fieldScorer) Fields() []string {
+	return []string{s.field}
+}
+
+func (s *fieldScorer) Prepare(ctx context.Context, db *mongo.Database, collection string) error {
+	return nil
+}
+
+func (s *fieldScorer) Score(doc bson.M) float64 {
+	return numberValue(doc[s.field])
+}
+
+// degreeScorer counts the statements of a statement collection an entity is the subject or object of.
+type degreeScorer struct {
+	statements string
+	degrees    map[string]float64
+}
+
+func (s *degreeScorer) Fields() []string {
+	return []string{}
+}
+
+func (s *degreeScorer) Prepare(ctx context.Context, db *mongo.Database, collection string) error {
+	counts, err := endpointCounts(ctx, db.Collection(s.statements))
+	if err != nil {
+		return err
+	}
+	s.degrees = make(map[string]float64, len(counts))
+	for uri, count := range counts {
+		s.degrees[uri] = float64(count)
+	}
+	return nil
+}
+
+func (s *degreeScorer) Score(doc bson.M) float64 {
+	uri, _ := doc["uri"].(string)
+	return s.degrees[uri]
+}
+
+// numberValue returns the value of a numeric document field, or 0.
+func numberValue(value interface{}) float64 {
+	switch number := value.(type) {
+	case int32:
+		return float64(number)
+	case int64:
+		return float64(number)
+	case float64:
+		return number
+	}
+	return 0
+}
+
+// firstTaxon returns the taxon of a document, or the first one of a merged duplicate.
+func firstTaxon(value interface{}) string {
+	switch taxon := value.(type) {
+	case string:
+		return taxon
+	case bson.A:
+		if len(taxon) > 0 {
+			first, _ := taxon[0].(string)
+			return first
+		}
+	}
+	return ""
+}
+
+// rankCollections computes the rank of the documents of every collection in the manifest's ranking.
+func rankCollections(ctx context.Context, client *mongo.Client) {
+	collections := make([]string, 0, len(manifest.Ranking))
+	for collection := range manifest.Ranking {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+	for _, collection := range collections {
+		if err := rankCollection(ctx, client.Database("metadb"), collection, manifest.Ranking[collection]); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// rankCollection sets rank, the weighted sum of the normalized component scores, on every document of a collection.
+// The raw and normalized score of each component are stored in rankComponents, so rankings can be explained.
+func rankCollection(ctx context.Context, db *mongo.Database, collection string, components []RankComponent) error {
+	if len(components) == 0 {
+		return nil
+	}
+	slog.Info("Ranking documents", "phase", "rank", "graph", collection)
+	projection := bson.M{"_id": 0, "uri": 1, "taxon": 1}
+	for _, component := range components {
+		scorer := scorers[component.Scorer]
+		for _, field := range scorer.Fields() {
+			projection[field] = 1
+		}
+		if err := scorer.Prepare(ctx, db, collection); err != nil {
+			return fmt.Errorf("[%s] %s scorer: %w", collection, component.Scorer, err)
+		}
+	}
+
+	cursor, err := db.Collection(collection).Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return err
+	}
+	uris := []string{}
+	taxa := []string{}
+	raw := make([][]float64, len(components))
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		uri, _ := doc["uri"].(string)
+		uris = append(uris, uri)
+		taxa = append(taxa, firstTaxon(doc["taxon"]))
+		for i, component := range components {
+			raw[i] = append(raw[i], scorers[component.Scorer].Score(doc))
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	cursor.Close(ctx)
+
+	normalized := make([][]float64, len(components))
+	for i, component := range components {
+		switch component.Normalize {
+		case "log":
+			normalized[i] = logNormalize(raw[i])
+		case "percentile":
+			normalized[i] = taxonPercentiles(raw[i], taxa)
+		default:
+			normalized[i] = raw[i]
+		}
+	}
+
+	updates := make(map[string]bson.M, len(uris))
+	for d, uri := range uris {
+		rank := 0.0
+		rankComponents := bson.M{}
+		for i, component := range components {
+			rank += component.Weight * normalized[i][d]
+			rankComponents[component.Scorer] = bson.M{"raw": raw[i][d], "score": normalized[i][d], "weight": component.Weight}
+		}
+		updates[uri] = bson.M{"rank": rank, "rankComponents": rankComponents}
+	}
+	return updateByURI(ctx, db.Collection(collection), updates)
+}
+
+// logNormalize maps the values to log(1+x) divided by the largest of them, so they are between 0 and 1.
+func logNormalize(values []float64) []float64 {
+	largest := 0.0
+	for _, value := range values {
+		largest = math.Max(largest, math.Log1p(math.Max(value, 0)))
+	}
+	normalized := make([]float64, len(values))
+	for i, value := range values {
+		if largest > 0 {
+			normalized[i] = math.Log1p(math.Max(value, 0)) / largest
+		}
+	}
+	return normalized
+}
+
+// taxonPercentiles maps each value to the fraction of the other values in its taxon that are smaller,
+// so the highest value of a taxon gets 1 and the lowest 0, however skewed the taxon's values are.
+func taxonPercentiles(values []float64, taxa []string) []float64 {
+	byTaxon := make(map[string][]float64)
+	for i, value := range values {
+		byTaxon[taxa[i]] = append(byTaxon[taxa[i]], value)
+	}
+	for _, sorted := range byTaxon {
+		sort.Float64s(sorted)
+	}
+	percentiles := make([]float64, len(values))
+	for i, value := range values {
+		sorted := byTaxon[taxa[i]]
+		if len(sorted) < 2 {
+			continue
+		}
+		smaller := sort.SearchFloat64s(sorted, value)
+		percentiles[i] = float64(smaller) / float64(len(sorted)-1)
+	}
+	return percentiles
+}
+
+// updateByURI sets fields on existing documents, with unordered bulk writes of copyBatchSize updates.
+func updateByURI(ctx context.Context, collection *mongo.Collection, updates map[string]bson.M) error {
+	uris := make([]string, 0, len(updates))
+	for uri := range updates {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	for start := 0; start < len(uris); start += copyBatchSize {
+		end := start + copyBatchSize
+		if end > len(uris) {
+			end = len(uris)
+		}
+		models := make([]mongo.WriteModel, 0, end-start)
+		for _, uri := range uris[start:end] {
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"uri": uri}).
+				SetUpdate(bson.M{"$set": updates[uri]}))
+		}
+		_, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if interruptedWrite(ctx, err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("updating %s: %w", collection.Name(), err)
+		}
+	}
+	slog.Info("Updated documents", "graph", collection.Name(), "count", len(updates))
+	return nil
+}
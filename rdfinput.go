@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Triple is a single RDF statement. All terms are kept in their N-Triples
+// serialization (<iri>, _:blank or "literal"@lang / "literal"^^<datatype>),
+// regardless of the syntax the file was written in, so the parsers can
+// compare predicates and clean values the same way for every input format.
+type Triple struct {
+	subject   string
+	predicate string
+	object    string
+	graph     string
+}
+
+// TripleScanner reads triples from an RDF source, in the same manner as bufio.Scanner.
+type TripleScanner interface {
+	Scan() bool
+	Triple() Triple
+	Line() int
+	Err() error
+	Close() error
+}
+
+var rdfSyntaxExtensions = []string{".nt", ".nq", ".ttl", ".obo", ".ofn", ".owl"}
+var compressionExtensions = []string{".gz", ".bz2", ".xz", ".zst"}
+
+var biogatewayGraphPrefix = "http://rdf.biogateway.eu/graph/"
+
+// maxLineSize is the longest line the line based readers accept. Some definitions are long.
+var maxLineSize = 16 * 1024 * 1024
+
+// splitRDFExtension splits a file name into the base name and its RDF syntax and compression extensions.
+// ok is false if the file does not look like an RDF file the builder can read.
+func splitRDFExtension(name string) (base string, syntax string, compression string, ok bool) {
+	base = name
+	for _, ext := range compressionExtensions {
+		if strings.HasSuffix(base, ext) {
+			compression = ext
+			base = strings.TrimSuffix(base, ext)
+			break
+		}
+	}
+	for _, ext := range rdfSyntaxExtensions {
+		if strings.HasSuffix(base, ext) {
+			syntax = ext
+			base = strings.TrimSuffix(base, ext)
+			return base, syntax, compression, true
+		}
+	}
+	return name, "", "", false
+}
+
+// findRDFFile returns the RDF file in dir named name, in any of the supported syntaxes and compressions.
+// Several files with the name are an error, see globRDFFiles.
+func findRDFFile(dir string, name string) (string, error) {
+	files, err := globRDFFiles(dir, name)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no RDF file named %s in %s", name, dir)
+	}
+	return files[0], nil
+}
+
+// globRDFFiles returns the RDF files in dir whose base name (without extensions) matches pattern.
+// The files are ordered by preference: N-Triples before N-Quads before Turtle before the ontology formats,
+// and uncompressed before compressed. Several files with the same base name, e.g. left over from a change of format,
+// are an error, as either could be the right one.
+func globRDFFiles(dir string, pattern string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, pattern+".*"))
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, syntax := range rdfSyntaxExtensions {
+		for _, compression := range append([]string{""}, compressionExtensions...) {
+			for _, match := range matches {
+				base, s, c, ok := splitRDFExtension(filepath.Base(match))
+				if !ok || s != syntax || c != compression {
+					continue
+				}
+				if matched, _ := filepath.Match(pattern, base); matched {
+					files = append(files, match)
+				}
+			}
+		}
+	}
+	if ambiguous := ambiguousFiles(files); len(ambiguous) > 0 {
+		return nil, fmt.Errorf("several RDF files with the same name in %s: %s", dir, strings.Join(ambiguous, ", "))
+	}
+	return files, nil
+}
+
+// ambiguousFiles returns the files that share their base name with another file, in another syntax or compression.
+func ambiguousFiles(files []string) []string {
+	byBase := make(map[string][]string)
+	for _, file := range files {
+		base, _, _, _ := splitRDFExtension(filepath.Base(file))
+		byBase[base] = append(byBase[base], file)
+	}
+	ambiguous := []string{}
+	for _, file := range files {
+		base, _, _, _ := splitRDFExtension(filepath.Base(file))
+		if len(byBase[base]) > 1 {
+			ambiguous = append(ambiguous, file)
+		}
+	}
+	return ambiguous
+}
+
+// openTriples opens an RDF file for reading triples into the given collection.
+// The compression is detected from the magic bytes of the file, and the syntax from the extension,
+// falling back to sniffing the first statement. Quads whose graph label routes to another collection
+// are skipped; triples without a graph label get the graph declared by a Virtuoso .graph file, if any.
+func openTriples(ctx context.Context, path string, collection string) (TripleScanner, error) {
+	f, err := openHashed(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	reader, closer, err := decompress(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	buffered := bufio.NewReaderSize(reader, 64*1024)
+	_, syntax, _, _ := splitRDFExtension(filepath.Base(path))
+	if syntax == "" {
+		syntax = sniffSyntax(buffered)
+	}
+
+	var scanner TripleScanner
+	switch syntax {
+	case ".ttl":
+		scanner = newTurtleScanner(buffered, path)
+	case ".obo":
+		scanner = newOBOScanner(buffered)
+	case ".ofn", ".owl":
+		if syntax == ".owl" && sniffSyntax(buffered) != ".ofn" {
+			closer.Close()
+			f.Close()
+			return nil, fmt.Errorf("%s: only OWL functional syntax is supported for .owl files", path)
+		}
+		scanner = newFunctionalScanner(buffered, path)
+	default:
+		scanner = newLineScanner(buffered, path)
+	}
+	return &routedScanner{
+		TripleScanner: scanner,
+		closers:       []io.Closer{closer},
+		input:         f,
+		collection:    collection,
+		defaultGraph:  sidecarGraph(path),
+		skipped:       make(map[string]bool),
+	}, nil
+}
+
+// decompress wraps r in a decompressor matching its magic bytes. Uncompressed input is returned as is.
+func decompress(r *bufio.Reader) (io.Reader, io.Closer, error) {
+	magic, _ := r.Peek(6)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gzReader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		return gzReader, gzReader, nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(r), nopCloser{}, nil
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		xzReader, err := xz.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create xz reader: %w", err)
+		}
+		return xzReader, nopCloser{}, nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zstdReader, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		return zstdReader, zstdCloser{zstdReader}, nil
+	}
+	return r, nopCloser{}, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+type zstdCloser struct {
+	decoder *zstd.Decoder
+}
+
+func (c zstdCloser) Close() error {
+	c.decoder.Close()
+	return nil
+}
+
+// sniffSyntax guesses the syntax of a file without a known extension from its first statement.
+func sniffSyntax(r *bufio.Reader) string {
+	head, _ := r.Peek(4096)
+	for _, line := range strings.Split(string(head), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "Prefix(") || strings.HasPrefix(line, "Ontology(") {
+			return ".ofn"
+		}
+		if strings.HasPrefix(line, "format-version:") {
+			return ".obo"
+		}
+		lower := strings.ToLower(line)
+		if strings.HasPrefix(lower, "@prefix") || strings.HasPrefix(lower, "@base") ||
+			strings.HasPrefix(lower, "prefix ") || strings.HasPrefix(lower, "base ") {
+			return ".ttl"
+		}
+		break
+	}
+	return ".nq"
+}
+
+// sidecarGraph returns the graph IRI declared for a file by the Virtuoso bulk loader conventions:
+// <file>.graph, <file without compression extension>.graph or global.graph in the same directory.
+func sidecarGraph(path string) string {
+	candidates := []string{path + ".graph"}
+	for _, ext := range compressionExtensions {
+		if strings.HasSuffix(path, ext) {
+			candidates = append(candidates, strings.TrimSuffix(path, ext)+".graph")
+		}
+	}
+	candidates = append(candidates, filepath.Join(filepath.Dir(path), "global.graph"))
+	for _, candidate := range candidates {
+		if content, err := os.ReadFile(candidate); err == nil {
+			return strings.TrimSpace(string(content))
+		}
+	}
+	return ""
+}
+
+// routeGraph returns the collection triples in the given graph belong to, or "" if the graph has no route.
+func routeGraph(graph string) string {
+	iri := removeLTGT(graph)
+	if collection, ok := manifest.GraphRoutes[iri]; ok {
+		return collection
+	}
+	if strings.HasPrefix(iri, biogatewayGraphPrefix) {
+		return strings.TrimPrefix(iri, biogatewayGraphPrefix)
+	}
+	return ""
+}
+
+// routedScanner skips the triples that are routed to another collection than the one being built.
+type routedScanner struct {
+	TripleScanner
+	closers      []io.Closer
+	input        *hashedFile
+	collection   string
+	defaultGraph string
+	skipped      map[string]bool
+	// unrouted keeps all triples, for files that are read whole for a collection.
+	unrouted bool
+}
+
+// openUnroutedTriples opens an RDF file like openTriples, but keeps the triples routed to other collections.
+// It is used for the ontologies that are only read for metadata, like NCBITaxon for the taxon collection.
+func openUnroutedTriples(ctx context.Context, path string, collection string) (TripleScanner, error) {
+	scanner, err := openTriples(ctx, path, collection)
+	if err != nil {
+		return nil, err
+	}
+	routed := scanner.(*routedScanner)
+	routed.unrouted = true
+	return routed, nil
+}
+
+func (s *routedScanner) Scan() bool {
+	for s.TripleScanner.Scan() {
+		if s.collection == "" || s.unrouted {
+			return true
+		}
+		graph := s.Triple().graph
+		if graph == "" {
+			graph = s.defaultGraph
+		}
+		route := routeGraph(graph)
+		if route == "" || route == s.collection {
+			return true
+		}
+		if !s.skipped[graph] {
+			slog.Info("Skipping triples routed to another collection", "graph", s.collection, "rdfGraph", graph, "route", route)
+			s.skipped[graph] = true
+		}
+	}
+	return false
+}
+
+func (s *routedScanner) Close() error {
+	var err error
+	for _, closer := range s.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	if finishErr := s.input.finish(s.collection, s.Line()); finishErr != nil && err == nil {
+		err = finishErr
+	}
+	return err
+}
+
+// lineScanner reads N-Triples and N-Quads, one statement per line.
+type lineScanner struct {
+	scanner *bufio.Scanner
+	name    string
+	line    int
+	triple  Triple
+	err     error
+}
+
+func newLineScanner(r io.Reader, name string) *lineScanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	return &lineScanner{scanner: scanner, name: name}
+}
+
+func (s *lineScanner) Scan() bool {
+	for s.scanner.Scan() {
+		s.line++
+		line := strings.TrimSpace(s.scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		triple, err := parseNQuadsLine(line)
+		if err != nil {
+			slog.Warn("Skipping line", "file", s.name, "line", s.line, "err", err)
+			continue
+		}
+		s.triple = triple
+		return true
+	}
+	s.err = s.scanner.Err()
+	return false
+}
+
+func (s *lineScanner) Triple() Triple {
+	return s.triple
+}
+
+func (s *lineScanner) Line() int {
+	return s.line
+}
+
+func (s *lineScanner) Err() error {
+	return s.err
+}
+
+func (s *lineScanner) Close() error {
+	return nil
+}
+
+// parseNQuadsLine parses an N-Triples or N-Quads statement. The terms are returned as written.
+func parseNQuadsLine(line string) (Triple, error) {
+	terms := make([]string, 0, 4)
+	rest := line
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+		if rest == "" {
+			return Triple{}, errors.New("missing final '.'")
+		}
+		if rest[0] == '.' {
+			if strings.TrimSpace(rest[1:]) != "" && !strings.HasPrefix(strings.TrimSpace(rest[1:]), "#") {
+				return Triple{}, errors.New("unexpected content after '.'")
+			}
+			break
+		}
+		term, remaining, err := nextNTriplesTerm(rest)
+		if err != nil {
+			return Triple{}, err
+		}
+		terms = append(terms, term)
+		rest = remaining
+	}
+	if len(terms) < 3 || len(terms) > 4 {
+		return Triple{}, fmt.Errorf("expected 3 or 4 terms, found %d", len(terms))
+	}
+	if strings.HasPrefix(terms[0], "\"") || !strings.HasPrefix(terms[1], "<") {
+		return Triple{}, errors.New("literal subject or non-IRI predicate")
+	}
+	triple := Triple{subject: terms[0], predicate: terms[1], object: terms[2]}
+	if len(terms) == 4 {
+		triple.graph = terms[3]
+	}
+	return triple, nil
+}
+
+// nextNTriplesTerm returns the term at the start of s and the remainder of s.
+func nextNTriplesTerm(s string) (string, string, error) {
+	switch s[0] {
+	case '<':
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return "", "", errors.New("unterminated IRI")
+		}
+		return s[:end+1], s[end+1:], nil
+	case '_':
+		end := strings.IndexAny(s, " \t")
+		if end < 0 {
+			end = len(s)
+		}
+		label := strings.TrimSuffix(s[:end], ".")
+		return label, s[len(label):], nil
+	case '"':
+		end := 1
+		for ; end < len(s); end++ {
+			if s[end] == '\\' {
+				end++
+				continue
+			}
+			if s[end] == '"' {
+				break
+			}
+		}
+		if end >= len(s) {
+			return "", "", errors.New("unterminated literal")
+		}
+		end++
+		if strings.HasPrefix(s[end:], "@") {
+			end++
+			for end < len(s) && (isASCIILetterOrDigit(s[end]) || s[end] == '-') {
+				end++
+			}
+		} else if strings.HasPrefix(s[end:], "^^<") {
+			close := strings.IndexByte(s[end:], '>')
+			if close < 0 {
+				return "", "", errors.New("unterminated datatype IRI")
+			}
+			end += close + 1
+		}
+		return s[:end], s[end:], nil
+	}
+	return "", "", fmt.Errorf("unexpected character %q", s[0])
+}
+
+func isASCIILetterOrDigit(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGlobRDFFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		pattern string
+		want    []string
+		err     string
+	}{
+		{"one file per source", []string{"intact_9606.nt.gz", "signor_9606.nq"}, "*9606", []string{"intact_9606.nt.gz", "signor_9606.nq"}, ""},
+		{"preferred syntax first", []string{"b_9606.ttl", "a_9606.nt"}, "*9606", []string{"a_9606.nt", "b_9606.ttl"}, ""},
+		{"other taxon", []string{"intact_9606.nt", "intact_10090.nt"}, "*9606", []string{"intact_9606.nt"}, ""},
+		{"two syntaxes", []string{"intact_9606.nt.gz", "intact_9606.nq.gz"}, "*9606", nil, "intact_9606.nt.gz"},
+		{"two compressions", []string{"9606.nt.gz", "9606.nt.zst"}, "9606", nil, "9606.nt.zst"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, file := range test.files {
+				if err := os.WriteFile(filepath.Join(dir, file), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			files, err := globRDFFiles(dir, test.pattern)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one naming %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, file := range files {
+				names = append(names, filepath.Base(file))
+			}
+			if strings.Join(names, ",") != strings.Join(test.want, ",") {
+				t.Errorf("got %v, want %v", names, test.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,9 @@
 #!/bin/bash
 if [ "$#" -lt 2 ]; then
-  echo "Usage: ./run <versionNumber> <VOS directory>"
+  echo "Usage: ./run <versionNumber> <VOS directory> [resume]"
   exit 1
 fi
 sudo rm build.log
-./build.sh $1 $2 20 >| build.log &
+./build.sh $1 $2 20 $3 >| build.log &
 echo "Starting build in detached mode."
 tail -f build.log
\ No newline at end of file
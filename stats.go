@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// statsPath is where the build statistics are written, besides the _stats collection.
+var statsPath = "stats.json"
+
+var statsCollection = "_stats"
+
+// BuildStats are the document counts of a build, per collection and taxon.
+type BuildStats struct {
+	Created     time.Time                  `json:"created" bson:"created"`
+	Collections map[string]CollectionStats `json:"collections" bson:"collections"`
+}
+
+type CollectionStats struct {
+	// Kind is the kind of documents in the collection, see collectionKinds.
+	Kind   string `json:"kind" bson:"kind"`
+	Counts `bson:",inline"`
+	Taxa   map[string]Counts `json:"taxa,omitempty" bson:"taxa,omitempty"`
+}
+
+// Counts are the statistics of a set of documents.
+type Counts struct {
+	Documents int `json:"documents" bson:"documents"`
+	// Labels counts the documents with a prefLabel, Synonyms all the synonyms of the documents.
+	Labels   int          `json:"labels" bson:"labels"`
+	Synonyms int          `json:"synonyms" bson:"synonyms"`
+	RefScore Distribution `json:"refScore" bson:"refScore"`
+}
+
+// Distribution summarizes a list of numbers.
+type Distribution struct {
+	Min  float64 `json:"min" bson:"min"`
+	Max  float64 `json:"max" bson:"max"`
+	Mean float64 `json:"mean" bson:"mean"`
+	P50  float64 `json:"p50" bson:"p50"`
+	P90  float64 `json:"p90" bson:"p90"`
+	P99  float64 `json:"p99" bson:"p99"`
+}
+
+func newDistribution(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sort.Float64s(values)
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	percentile := func(p float64) float64 {
+		return values[int(p*float64(len(values)-1))]
+	}
+	return Distribution{
+		Min:  values[0],
+		Max:  values[len(values)-1],
+		Mean: sum / float64(len(values)),
+		P50:  percentile(0.5),
+		P90:  percentile(0.9),
+		P99:  percentile(0.99),
+	}
+}
+
+// collectBuildStats counts the documents of the loaded collections, writes the counts to the _stats collection
+// and to statsPath, and returns them.
+func collectBuildStats(ctx context.Context, client *mongo.Client) BuildStats {
+	db := client.Database("metadb")
+	stats := BuildStats{Created: time.Now().UTC(), Collections: make(map[string]CollectionStats)}
+	for _, collection := range loadedCollections() {
+		collectionStats, err := countCollection(ctx, db.Collection(collection))
+		if err != nil {
+			panic(err)
+		}
+		stats.Collections[collection] = collectionStats
+	}
+
+	_, err := db.Collection(statsCollection).ReplaceOne(ctx, bson.M{"_id": "stats"}, stats, options.Replace().SetUpsert(true))
+	if err != nil {
+		panic(err)
+	}
+	content, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile(statsPath, content, 0644); err != nil {
+		slog.Error("Error writing build statistics", "file", statsPath, "err", err)
+	}
+	slog.Info("Build statistics written", "phase", "validate", "file", statsPath)
+	return stats
+}
+
+func countCollection(ctx context.Context, collection *mongo.Collection) (CollectionStats, error) {
+	cursor, err := collection.Find(ctx, bson.M{},
+		options.Find().SetProjection(bson.M{"_id": 0, "taxon": 1, "prefLabel": 1, "synonyms": 1, "refScore": 1}))
+	if err != nil {
+		return CollectionStats{}, err
+	}
+	defer cursor.Close(ctx)
+
+	total := Counts{}
+	totalScores := []float64{}
+	taxa := make(map[string]Counts)
+	taxonScores := make(map[string][]float64)
+	for cursor.Next(ctx) {
+		var doc struct {
+			Taxon     interface{} `bson:"taxon"`
+			PrefLabel string      `bson:"prefLabel"`
+			Synonyms  []string    `bson:"synonyms"`
+			RefScore  interface{} `bson:"refScore"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return CollectionStats{}, err
+		}
+		taxon := strings.TrimPrefix(firstTaxon(doc.Taxon), taxonPrefix)
+		counts := taxa[taxon]
+		for _, c := range []*Counts{&total, &counts} {
+			c.Documents++
+			c.Synonyms += len(doc.Synonyms)
+			if doc.PrefLabel != "" {
+				c.Labels++
+			}
+		}
+		taxa[taxon] = counts
+		if doc.RefScore != nil {
+			score := numberValue(doc.RefScore)
+			totalScores = append(totalScores, score)
+			taxonScores[taxon] = append(taxonScores[taxon], score)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return CollectionStats{}, err
+	}
+
+	total.RefScore = newDistribution(totalScores)
+	kind := collectionKinds[collection.Name()]
+	if kind == "" {
+		kind = "statement"
+	}
+	stats := CollectionStats{Kind: kind, Counts: total}
+	// Collections without taxa, like goall, have no per-taxon counts.
+	if len(taxa) > 1 || taxa[""].Documents == 0 {
+		stats.Taxa = make(map[string]Counts)
+		for taxon, counts := range taxa {
+			counts.RefScore = newDistribution(taxonScores[taxon])
+			stats.Taxa[taxon] = counts
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// taxonCollection holds one document per taxon, with its names and the number of documents per collection.
+var taxonCollection = "taxon"
+
+var hasRankRT = "<http://purl.obolibrary.org/obo/ncbitaxon#has_rank>"
+
+// TaxonInfo holds the names and rank of an NCBI taxon.
+type TaxonInfo struct {
+	scientificName string
+	commonNames    []string
+	rank           string
+}
+
+// loadTaxonInfo reads the names and ranks of the taxa from names.dmp and nodes.dmp in <rdfPath>/taxonomy,
+// or else from the NCBITaxon ontology in <rdfPath>/onto. Taxa that are not wanted are skipped.
+func loadTaxonInfo(ctx context.Context, rdfPath string, wanted map[string]bool) (map[string]TaxonInfo, error) {
+	namesPath := rdfPath + "/taxonomy/names.dmp"
+	if _, err := os.Stat(namesPath); err == nil {
+		return loadTaxonDump(ctx, namesPath, rdfPath+"/taxonomy/nodes.dmp", wanted)
+	}
+	path, err := findRDFFile(rdfPath+"/onto", "ncbitaxon")
+	if err != nil {
+		return nil, err
+	}
+	return loadTaxonOntology(ctx, path, wanted)
+}
+
+// loadTaxonDump reads the NCBI taxonomy dump files. nodes.dmp is optional, without it the taxa have no rank.
+func loadTaxonDump(ctx context.Context, namesPath string, nodesPath string, wanted map[string]bool) (map[string]TaxonInfo, error) {
+	info := make(map[string]TaxonInfo)
+	err := readDumpFile(ctx, namesPath, func(fields []string) {
+		if len(fields) < 4 || !wanted[fields[0]] {
+			return
+		}
+		entry := info[fields[0]]
+		switch fields[3] {
+		case "scientific name":
+			entry.scientificName = fields[1]
+		case "genbank common name":
+			// The GenBank common name is the preferred one.
+			entry.commonNames = append([]string{fields[1]}, entry.commonNames...)
+		case "common name":
+			entry.commonNames = append(entry.commonNames, fields[1])
+		}
+		info[fields[0]] = entry
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(nodesPath); err != nil {
+		return info, nil
+	}
+	err = readDumpFile(ctx, nodesPath, func(fields []string) {
+		if len(fields) < 3 || !wanted[fields[0]] {
+			return
+		}
+		entry := info[fields[0]]
+		entry.rank = fields[2]
+		info[fields[0]] = entry
+	})
+	return info, err
+}
+
+// readDumpFile calls read with the fields of every line of an NCBI taxonomy dump file, which are separated by "\t|\t".
+func readDumpFile(ctx context.Context, path string, read func(fields []string)) error {
+	file, err := openHashed(ctx, path)
+	if err != nil {
+		return err
+	}
+	lines := bufio.NewScanner(file)
+	lines.Buffer(make([]byte, 64*1024), maxLineSize)
+	lineNumber := 0
+	for lines.Scan() {
+		if ctx.Err() != nil {
+			file.Close()
+			return ctx.Err()
+		}
+		lineNumber++
+		line := strings.TrimSuffix(strings.TrimSuffix(lines.Text(), "\t|"), "|")
+		read(strings.Split(line, "\t|\t"))
+	}
+	if err := lines.Err(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.finish(taxonCollection, lineNumber)
+}
+
+// loadTaxonOntology reads the labels, synonyms and ranks of the taxa from the NCBITaxon ontology.
+// The label is the scientific name, and the exact and related synonyms are used as common names.
+// The graph routes of the manifest do not apply, the whole ontology is read.
+func loadTaxonOntology(ctx context.Context, path string, wanted map[string]bool) (map[string]TaxonInfo, error) {
+	scanner, err := openUnroutedTriples(ctx, path, taxonCollection)
+	if err != nil {
+		return nil, err
+	}
+	defer scanner.Close()
+	info := make(map[string]TaxonInfo)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		triple := scanner.Triple()
+		id := strings.TrimPrefix(removeLTGT(triple.subject), taxonPrefix)
+		if !wanted[id] {
+			continue
+		}
+		entry := info[id]
+		switch triple.predicate {
+		case labelRT:
+			entry.scientificName = parseLiteral(triple.object).value
+		case oboSynonymRTs["EXACT"], oboSynonymRTs["RELATED"]:
+			entry.commonNames = append(entry.commonNames, parseLiteral(triple.object).value)
+		case hasRankRT:
+			rank := removeLTGT(triple.object)
+			entry.rank = strings.ReplaceAll(strings.TrimPrefix(rank, oboNamespace+"NCBITaxon_"), "_", " ")
+		default:
+			continue
+		}
+		info[id] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(info) == 0 && len(wanted) > 0 {
+		return nil, fmt.Errorf("none of the %d taxa was found in %s", len(wanted), path)
+	}
+	return info, nil
+}
+
+// refScoreCounts holds the number of statements of the graphs that are only read for the refScores (prot2bp, prot2cc,
+// prot2mf and gene2phen), by taxon ID and graph, since they are not loaded into collections.
+var refScoreCounts = struct {
+	sync.Mutex
+	counts map[string]map[string]int
+}{counts: make(map[string]map[string]int)}
+
+// countRefScoreStatement counts a statement of a graph read for the refScores.
+func countRefScoreStatement(graph string, taxon string) {
+	refScoreCounts.Lock()
+	defer refScoreCounts.Unlock()
+	if refScoreCounts.counts[taxon] == nil {
+		refScoreCounts.counts[taxon] = make(map[string]int)
+	}
+	refScoreCounts.counts[taxon][graph]++
+}
+
+// taxonCounts counts the documents of each taxon in the loaded entity and statement collections, and the statements
+// of the graphs read for the refScores, by taxon ID and collection.
+func taxonCounts(ctx context.Context, db *mongo.Database) (map[string]map[string]int, error) {
+	counts := make(map[string]map[string]int)
+	refScoreCounts.Lock()
+	for id, graphs := range refScoreCounts.counts {
+		counts[id] = make(map[string]int)
+		for graph, count := range graphs {
+			counts[id][graph] = count
+		}
+	}
+	refScoreCounts.Unlock()
+	for _, collection := range loadedCollections() {
+		kind := collectionKinds[collection]
+		if kind != "" && kind != "entity" {
+			continue
+		}
+		cursor, err := db.Collection(collection).Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: hasTaxon}},
+			{{Key: "$unwind", Value: "$taxon"}},
+			{{Key: "$group", Value: bson.M{"_id": "$taxon", "count": bson.M{"$sum": 1}}}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for cursor.Next(ctx) {
+			var result struct {
+				Taxon string `bson:"_id"`
+				Count int    `bson:"count"`
+			}
+			if err := cursor.Decode(&result); err != nil {
+				cursor.Close(ctx)
+				return nil, err
+			}
+			id := strings.TrimPrefix(result.Taxon, taxonPrefix)
+			if counts[id] == nil {
+				counts[id] = make(map[string]int)
+			}
+			counts[id][collection] = result.Count
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// buildTaxonCollection writes a document for each taxon in the taxa list or in the loaded data, with its names, rank
+// and document counts. Taxa without names are still written, and listed in the log.
+func buildTaxonCollection(ctx context.Context, rdfPath string, client *mongo.Client) {
+	db := client.Database("metadb")
+	counts, err := taxonCounts(ctx, db)
+	if err != nil {
+		panic(err)
+	}
+	wanted := make(map[string]bool)
+	for _, taxon := range taxa {
+		wanted[taxon] = true
+	}
+	for taxon := range counts {
+		wanted[taxon] = true
+	}
+	info, err := loadTaxonInfo(ctx, rdfPath, wanted)
+	if err != nil {
+		slog.Warn("No taxon names", "phase", "link", "graph", taxonCollection, "err", err)
+	}
+
+	ids := make([]string, 0, len(wanted))
+	for id := range wanted {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	prepareCollection(ctx, client, taxonCollection)
+	updateOptions := options.Update().SetUpsert(true)
+	for _, id := range ids {
+		entry := info[id]
+		if entry.scientificName == "" {
+			slog.Warn("No scientific name", "phase", "link", "graph", taxonCollection, "taxon", id)
+		}
+		entityCount := 0
+		statementCount := 0
+		for collection, count := range counts[id] {
+			if collectionKinds[collection] == "entity" {
+				entityCount += count
+			} else {
+				statementCount += count
+			}
+		}
+		commonName := ""
+		commonNames := []string{}
+		if len(entry.commonNames) > 0 {
+			commonName = entry.commonNames[0]
+			commonNames = entry.commonNames
+		}
+		collectionCounts := counts[id]
+		if collectionCounts == nil {
+			collectionCounts = map[string]int{}
+		}
+		doc := bson.M{
+			"uri":            taxonPrefix + id,
+			"taxonId":        id,
+			"prefLabel":      entry.scientificName,
+			"lcLabel":        strings.ToLower(entry.scientificName),
+			"normLabel":      normalizeSearchText(entry.scientificName),
+			"scientificName": entry.scientificName,
+			"commonName":     commonName,
+			"synonyms":       commonNames,
+			"taxonRank":      entry.rank,
+			"counts":         collectionCounts,
+			"entityCount":    entityCount,
+			"statementCount": statementCount,
+		}
+		setCURIE(doc, taxonPrefix+id)
+		_, err := db.Collection(taxonCollection).UpdateOne(
+			ctx,
+			bson.M{"uri": taxonPrefix + id},
+			bson.M{"$set": doc},
+			updateOptions)
+		if err != nil {
+			panic(err)
+		}
+	}
+	slog.Info("Wrote taxa", "phase", "link", "graph", taxonCollection, "count", len(ids))
+}
@@ -0,0 +1,728 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+var xsdNamespace = "http://www.w3.org/2001/XMLSchema#"
+
+type turtleTokenKind int
+
+const (
+	tokEOF turtleTokenKind = iota
+	tokIRI
+	tokPrefixedName
+	tokBlankNode
+	tokString
+	tokLangTag
+	tokDatatypeMark
+	tokInteger
+	tokDecimal
+	tokDouble
+	tokWord
+	tokPunctuation
+)
+
+type turtleToken struct {
+	kind turtleTokenKind
+	text string
+	line int
+}
+
+// turtleScanner is a streaming Turtle reader. It parses one statement at a time
+// and hands out the triples it produced before reading the next statement.
+type turtleScanner struct {
+	reader    *bufio.Reader
+	name      string
+	pushback  []rune
+	peeked    *turtleToken
+	line      int
+	prefixes  map[string]string
+	base      string
+	blankNode int
+	pending   []Triple
+	triple    Triple
+	done      bool
+	err       error
+}
+
+func newTurtleScanner(r *bufio.Reader, name string) *turtleScanner {
+	return &turtleScanner{
+		reader:   r,
+		name:     name,
+		line:     1,
+		prefixes: make(map[string]string),
+	}
+}
+
+func (s *turtleScanner) Scan() bool {
+	for len(s.pending) == 0 {
+		if s.done {
+			return false
+		}
+		if err := s.statement(); err != nil {
+			// Triples parsed before an error are still handed out.
+			s.done = true
+			if err != io.EOF {
+				s.err = fmt.Errorf("%s line %d: %w", s.name, s.line, err)
+			}
+		}
+	}
+	s.triple = s.pending[0]
+	s.pending = s.pending[1:]
+	return true
+}
+
+func (s *turtleScanner) Triple() Triple {
+	return s.triple
+}
+
+func (s *turtleScanner) Line() int {
+	return s.line
+}
+
+func (s *turtleScanner) Err() error {
+	return s.err
+}
+
+func (s *turtleScanner) Close() error {
+	return nil
+}
+
+// statement parses a directive or a set of triples terminated by '.'.
+func (s *turtleScanner) statement() error {
+	tok, err := s.next()
+	if err != nil {
+		return err
+	}
+	switch {
+	case tok.kind == tokEOF:
+		return io.EOF
+	case tok.kind == tokLangTag && (tok.text == "prefix" || tok.text == "base"):
+		if err := s.directive(tok.text); err != nil {
+			return err
+		}
+		return s.expect(".")
+	case tok.kind == tokWord && (strings.EqualFold(tok.text, "prefix") || strings.EqualFold(tok.text, "base")):
+		return s.directive(strings.ToLower(tok.text))
+	}
+	s.unread(tok)
+	if err := s.triples(); err != nil {
+		return err
+	}
+	return s.expect(".")
+}
+
+func (s *turtleScanner) directive(name string) error {
+	if name == "prefix" {
+		tok, err := s.next()
+		if err != nil {
+			return err
+		}
+		if tok.kind != tokPrefixedName || !strings.HasSuffix(tok.text, ":") {
+			return fmt.Errorf("expected prefix name, found %q", tok.text)
+		}
+		iri, err := s.next()
+		if err != nil {
+			return err
+		}
+		if iri.kind != tokIRI {
+			return fmt.Errorf("expected IRI for prefix %s, found %q", tok.text, iri.text)
+		}
+		s.prefixes[strings.TrimSuffix(tok.text, ":")] = s.resolve(iri.text)
+		return nil
+	}
+	iri, err := s.next()
+	if err != nil {
+		return err
+	}
+	if iri.kind != tokIRI {
+		return fmt.Errorf("expected base IRI, found %q", iri.text)
+	}
+	s.base = s.resolve(iri.text)
+	return nil
+}
+
+func (s *turtleScanner) triples() error {
+	tok, err := s.next()
+	if err != nil {
+		return err
+	}
+	if tok.kind == tokPunctuation && tok.text == "[" {
+		subject, err := s.blankNodePropertyList()
+		if err != nil {
+			return err
+		}
+		next, err := s.peek()
+		if err != nil {
+			return err
+		}
+		if next.kind == tokPunctuation && next.text == "." {
+			return nil
+		}
+		return s.predicateObjectList(subject)
+	}
+	subject, err := s.term(tok, false)
+	if err != nil {
+		return err
+	}
+	return s.predicateObjectList(subject)
+}
+
+func (s *turtleScanner) predicateObjectList(subject string) error {
+	for {
+		tok, err := s.next()
+		if err != nil {
+			return err
+		}
+		var predicate string
+		if tok.kind == tokWord && tok.text == "a" {
+			predicate = "<" + rdfNamespace + "type>"
+		} else if tok.kind == tokIRI || tok.kind == tokPrefixedName {
+			if predicate, err = s.term(tok, false); err != nil {
+				return err
+			}
+		} else {
+			return fmt.Errorf("expected predicate, found %q", tok.text)
+		}
+		if err := s.objectList(subject, predicate); err != nil {
+			return err
+		}
+
+		sawSemicolon := false
+		for {
+			next, err := s.peek()
+			if err != nil {
+				return err
+			}
+			if next.kind != tokPunctuation || next.text != ";" {
+				break
+			}
+			sawSemicolon = true
+			s.next()
+		}
+		if !sawSemicolon {
+			return nil
+		}
+		next, err := s.peek()
+		if err != nil {
+			return err
+		}
+		if next.kind == tokEOF || (next.kind == tokPunctuation && (next.text == "." || next.text == "]")) {
+			return nil
+		}
+	}
+}
+
+func (s *turtleScanner) objectList(subject string, predicate string) error {
+	for {
+		tok, err := s.next()
+		if err != nil {
+			return err
+		}
+		object, err := s.term(tok, true)
+		if err != nil {
+			return err
+		}
+		s.emit(subject, predicate, object)
+
+		next, err := s.peek()
+		if err != nil {
+			return err
+		}
+		if next.kind != tokPunctuation || next.text != "," {
+			return nil
+		}
+		s.next()
+	}
+}
+
+// blankNodePropertyList parses the contents of [ ... ] after the opening bracket.
+func (s *turtleScanner) blankNodePropertyList() (string, error) {
+	node := s.newBlankNode()
+	next, err := s.peek()
+	if err != nil {
+		return "", err
+	}
+	if next.kind == tokPunctuation && next.text == "]" {
+		s.next()
+		return node, nil
+	}
+	if err := s.predicateObjectList(node); err != nil {
+		return "", err
+	}
+	return node, s.expect("]")
+}
+
+// collection parses the contents of ( ... ) after the opening parenthesis into an rdf:List.
+func (s *turtleScanner) collection() (string, error) {
+	head := "<" + rdfNamespace + "nil>"
+	previous := ""
+	for {
+		tok, err := s.next()
+		if err != nil {
+			return "", err
+		}
+		if tok.kind == tokPunctuation && tok.text == ")" {
+			if previous != "" {
+				s.emit(previous, "<"+rdfNamespace+"rest>", "<"+rdfNamespace+"nil>")
+			}
+			return head, nil
+		}
+		item, err := s.term(tok, true)
+		if err != nil {
+			return "", err
+		}
+		node := s.newBlankNode()
+		if previous == "" {
+			head = node
+		} else {
+			s.emit(previous, "<"+rdfNamespace+"rest>", node)
+		}
+		s.emit(node, "<"+rdfNamespace+"first>", item)
+		previous = node
+	}
+}
+
+// term converts a token to its N-Triples form. Literals are only accepted in object position.
+func (s *turtleScanner) term(tok turtleToken, object bool) (string, error) {
+	switch tok.kind {
+	case tokIRI:
+		return "<" + s.resolve(tok.text) + ">", nil
+	case tokPrefixedName:
+		iri, err := s.expand(tok.text)
+		if err != nil {
+			return "", err
+		}
+		return "<" + iri + ">", nil
+	case tokBlankNode:
+		return "_:" + tok.text, nil
+	case tokPunctuation:
+		if tok.text == "[" {
+			return s.blankNodePropertyList()
+		}
+		if tok.text == "(" {
+			return s.collection()
+		}
+	}
+	if !object {
+		return "", fmt.Errorf("unexpected %q", tok.text)
+	}
+	switch tok.kind {
+	case tokString:
+		literal := "\"" + escapeNTriplesString(tok.text) + "\""
+		next, err := s.peek()
+		if err != nil {
+			return "", err
+		}
+		if next.kind == tokLangTag {
+			s.next()
+			return literal + "@" + next.text, nil
+		}
+		if next.kind == tokDatatypeMark {
+			s.next()
+			datatype, err := s.next()
+			if err != nil {
+				return "", err
+			}
+			if datatype.kind != tokIRI && datatype.kind != tokPrefixedName {
+				return "", fmt.Errorf("expected datatype IRI, found %q", datatype.text)
+			}
+			datatypeTerm, err := s.term(datatype, false)
+			if err != nil {
+				return "", err
+			}
+			return literal + "^^" + datatypeTerm, nil
+		}
+		return literal, nil
+	case tokInteger:
+		return "\"" + tok.text + "\"^^<" + xsdNamespace + "integer>", nil
+	case tokDecimal:
+		return "\"" + tok.text + "\"^^<" + xsdNamespace + "decimal>", nil
+	case tokDouble:
+		return "\"" + tok.text + "\"^^<" + xsdNamespace + "double>", nil
+	case tokWord:
+		if tok.text == "true" || tok.text == "false" {
+			return "\"" + tok.text + "\"^^<" + xsdNamespace + "boolean>", nil
+		}
+	}
+	return "", fmt.Errorf("unexpected %q", tok.text)
+}
+
+func (s *turtleScanner) emit(subject string, predicate string, object string) {
+	s.pending = append(s.pending, Triple{subject: subject, predicate: predicate, object: object})
+}
+
+func (s *turtleScanner) newBlankNode() string {
+	s.blankNode++
+	return "_:ttl" + strconv.Itoa(s.blankNode)
+}
+
+func (s *turtleScanner) expand(name string) (string, error) {
+	colon := strings.IndexByte(name, ':')
+	prefix, local := name[:colon], name[colon+1:]
+	namespace, ok := s.prefixes[prefix]
+	if !ok {
+		return "", fmt.Errorf("undefined prefix %q", prefix)
+	}
+	return namespace + unescapeLocalName(local), nil
+}
+
+func (s *turtleScanner) resolve(iri string) string {
+	if s.base == "" || strings.Contains(iri, ":") {
+		return iri
+	}
+	base, err := url.Parse(s.base)
+	if err != nil {
+		return iri
+	}
+	reference, err := url.Parse(iri)
+	if err != nil {
+		return iri
+	}
+	return base.ResolveReference(reference).String()
+}
+
+func (s *turtleScanner) expect(punctuation string) error {
+	tok, err := s.next()
+	if err != nil {
+		return err
+	}
+	if tok.kind != tokPunctuation || tok.text != punctuation {
+		if tok.kind == tokEOF {
+			return fmt.Errorf("expected %q, found end of file", punctuation)
+		}
+		return fmt.Errorf("expected %q, found %q", punctuation, tok.text)
+	}
+	return nil
+}
+
+func (s *turtleScanner) peek() (turtleToken, error) {
+	if s.peeked != nil {
+		return *s.peeked, nil
+	}
+	tok, err := s.lex()
+	if err != nil {
+		return tok, err
+	}
+	s.peeked = &tok
+	return tok, nil
+}
+
+func (s *turtleScanner) next() (turtleToken, error) {
+	if s.peeked != nil {
+		tok := *s.peeked
+		s.peeked = nil
+		return tok, nil
+	}
+	return s.lex()
+}
+
+func (s *turtleScanner) unread(tok turtleToken) {
+	s.peeked = &tok
+}
+
+func (s *turtleScanner) readRune() (rune, error) {
+	if n := len(s.pushback); n > 0 {
+		r := s.pushback[n-1]
+		s.pushback = s.pushback[:n-1]
+		if r == '\n' {
+			s.line++
+		}
+		return r, nil
+	}
+	r, _, err := s.reader.ReadRune()
+	if err == nil && r == '\n' {
+		s.line++
+	}
+	return r, err
+}
+
+func (s *turtleScanner) unreadRune(r rune) {
+	if r == '\n' {
+		s.line--
+	}
+	s.pushback = append(s.pushback, r)
+}
+
+// lex reads the next token, skipping whitespace and comments.
+func (s *turtleScanner) lex() (turtleToken, error) {
+	var r rune
+	var err error
+	for {
+		r, err = s.readRune()
+		if err == io.EOF {
+			return turtleToken{kind: tokEOF, line: s.line}, nil
+		}
+		if err != nil {
+			return turtleToken{}, err
+		}
+		if r == '#' {
+			for r != '\n' {
+				if r, err = s.readRune(); err != nil {
+					break
+				}
+			}
+			continue
+		}
+		if !unicode.IsSpace(r) {
+			break
+		}
+	}
+	line := s.line
+
+	switch {
+	case r == '<':
+		iri, err := s.readUntil('>')
+		return turtleToken{kind: tokIRI, text: unescapeUnicode(iri), line: line}, err
+	case r == '"' || r == '\'':
+		value, err := s.readString(r)
+		return turtleToken{kind: tokString, text: value, line: line}, err
+	case r == '@':
+		name := s.readWhile(func(r rune) bool { return r < utf8.RuneSelf && isASCIILetterOrDigit(byte(r)) || r == '-' })
+		return turtleToken{kind: tokLangTag, text: name, line: line}, nil
+	case r == '^':
+		if next, _ := s.readRune(); next != '^' {
+			return turtleToken{}, errors.New("expected '^^'")
+		}
+		return turtleToken{kind: tokDatatypeMark, text: "^^", line: line}, nil
+	case r == '_':
+		if next, _ := s.readRune(); next != ':' {
+			return turtleToken{}, errors.New("expected '_:'")
+		}
+		return turtleToken{kind: tokBlankNode, text: s.readName(), line: line}, nil
+	case strings.ContainsRune(".;,[]()", r):
+		return turtleToken{kind: tokPunctuation, text: string(r), line: line}, nil
+	case r == '+' || r == '-' || (r >= '0' && r <= '9'):
+		s.unreadRune(r)
+		return s.readNumber(line)
+	}
+
+	s.unreadRune(r)
+	name := s.readName()
+	if name == "" {
+		return turtleToken{}, fmt.Errorf("unexpected character %q", r)
+	}
+	if strings.Contains(name, ":") {
+		return turtleToken{kind: tokPrefixedName, text: name, line: line}, nil
+	}
+	return turtleToken{kind: tokWord, text: name, line: line}, nil
+}
+
+func (s *turtleScanner) readUntil(end rune) (string, error) {
+	var b strings.Builder
+	for {
+		r, err := s.readRune()
+		if err != nil {
+			return b.String(), fmt.Errorf("unterminated token, expected %q", end)
+		}
+		if r == end {
+			return b.String(), nil
+		}
+		b.WriteRune(r)
+	}
+}
+
+func (s *turtleScanner) readWhile(accept func(rune) bool) string {
+	var b strings.Builder
+	for {
+		r, err := s.readRune()
+		if err != nil {
+			return b.String()
+		}
+		if !accept(r) {
+			s.unreadRune(r)
+			return b.String()
+		}
+		b.WriteRune(r)
+	}
+}
+
+// readName reads a prefixed name, blank node label or keyword. A trailing '.' ends the statement and is not part of the name.
+func (s *turtleScanner) readName() string {
+	name := s.readWhile(func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.:%\\", r) || r == 0xB7
+	})
+	for strings.HasSuffix(name, ".") && !strings.HasSuffix(name, "\\.") {
+		s.unreadRune('.')
+		name = strings.TrimSuffix(name, ".")
+	}
+	return name
+}
+
+func (s *turtleScanner) readNumber(line int) (turtleToken, error) {
+	text := s.readWhile(func(r rune) bool {
+		return (r >= '0' && r <= '9') || strings.ContainsRune("+-.eE", r)
+	})
+	for strings.HasSuffix(text, ".") {
+		s.unreadRune('.')
+		text = strings.TrimSuffix(text, ".")
+	}
+	switch {
+	case strings.ContainsAny(text, "eE"):
+		return turtleToken{kind: tokDouble, text: text, line: line}, nil
+	case strings.Contains(text, "."):
+		return turtleToken{kind: tokDecimal, text: text, line: line}, nil
+	case text == "" || text == "+" || text == "-":
+		return turtleToken{}, fmt.Errorf("invalid number %q", text)
+	}
+	return turtleToken{kind: tokInteger, text: text, line: line}, nil
+}
+
+// readString reads a short or long (triple quoted) string literal after its first quote.
+func (s *turtleScanner) readString(quote rune) (string, error) {
+	long := false
+	second, err := s.readRune()
+	if err != nil {
+		return "", errors.New("unterminated string")
+	}
+	if second == quote {
+		third, err := s.readRune()
+		if err == nil && third == quote {
+			long = true
+		} else {
+			if err == nil {
+				s.unreadRune(third)
+			}
+			return "", nil
+		}
+	} else {
+		s.unreadRune(second)
+	}
+
+	var b strings.Builder
+	quotes := 0
+	for {
+		r, err := s.readRune()
+		if err != nil {
+			return "", errors.New("unterminated string")
+		}
+		if r == '\\' {
+			escaped, err := s.readEscape()
+			if err != nil {
+				return "", err
+			}
+			for ; quotes > 0; quotes-- {
+				b.WriteRune(quote)
+			}
+			b.WriteString(escaped)
+			continue
+		}
+		if r == quote {
+			if !long {
+				return b.String(), nil
+			}
+			quotes++
+			if quotes == 3 {
+				return b.String(), nil
+			}
+			continue
+		}
+		if !long && (r == '\n' || r == '\r') {
+			return "", errors.New("line break in string")
+		}
+		for ; quotes > 0; quotes-- {
+			b.WriteRune(quote)
+		}
+		b.WriteRune(r)
+	}
+}
+
+func (s *turtleScanner) readEscape() (string, error) {
+	r, err := s.readRune()
+	if err != nil {
+		return "", errors.New("unterminated escape sequence")
+	}
+	switch r {
+	case 't':
+		return "\t", nil
+	case 'b':
+		return "\b", nil
+	case 'n':
+		return "\n", nil
+	case 'r':
+		return "\r", nil
+	case 'f':
+		return "\f", nil
+	case '"', '\'', '\\':
+		return string(r), nil
+	case 'u', 'U':
+		length := 4
+		if r == 'U' {
+			length = 8
+		}
+		var hex strings.Builder
+		for i := 0; i < length; i++ {
+			h, err := s.readRune()
+			if err != nil {
+				return "", errors.New("unterminated unicode escape")
+			}
+			hex.WriteRune(h)
+		}
+		code, err := strconv.ParseUint(hex.String(), 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid unicode escape \\%c%s", r, hex.String())
+		}
+		return string(rune(code)), nil
+	}
+	return "", fmt.Errorf("invalid escape sequence \\%c", r)
+}
+
+// unescapeUnicode decodes \uXXXX and \UXXXXXXXX escapes in IRIs.
+func unescapeUnicode(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) && (value[i+1] == 'u' || value[i+1] == 'U') {
+			length := 4
+			if value[i+1] == 'U' {
+				length = 8
+			}
+			if i+2+length <= len(value) {
+				if code, err := strconv.ParseUint(value[i+2:i+2+length], 16, 32); err == nil {
+					b.WriteRune(rune(code))
+					i += 1 + length
+					continue
+				}
+			}
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// unescapeLocalName removes the backslashes from reserved characters in the local part of a prefixed name.
+func unescapeLocalName(local string) string {
+	if !strings.Contains(local, "\\") {
+		return local
+	}
+	var b strings.Builder
+	for i := 0; i < len(local); i++ {
+		if local[i] == '\\' && i+1 < len(local) {
+			i++
+		}
+		b.WriteByte(local[i])
+	}
+	return b.String()
+}
+
+// escapeNTriplesString escapes a literal value for its N-Triples serialization.
+func escapeNTriplesString(value string) string {
+	return strings.NewReplacer(
+		"\\", "\\\\",
+		"\"", "\\\"",
+		"\n", "\\n",
+		"\r", "\\r",
+	).Replace(value)
+}
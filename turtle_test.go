@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+const (
+	testRDF = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	testXSD = "http://www.w3.org/2001/XMLSchema#"
+)
+
+// scanTurtle returns the triples of a Turtle document as "subject predicate object" lines, and the scanner's error.
+func scanTurtle(input string) ([]string, error) {
+	scanner := newTurtleScanner(bufio.NewReader(strings.NewReader(input)), "test.ttl")
+	triples := []string{}
+	for scanner.Scan() {
+		triple := scanner.Triple()
+		triples = append(triples, triple.subject+" "+triple.predicate+" "+triple.object)
+	}
+	return triples, scanner.Err()
+}
+
+func TestTurtleScanner(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		triples []string
+	}{
+		{
+			name:    "IRIs",
+			input:   `<http://ex.org/s> <http://ex.org/p> <http://ex.org/o> .`,
+			triples: []string{"<http://ex.org/s> <http://ex.org/p> <http://ex.org/o>"},
+		},
+		{
+			name:    "prefix directive",
+			input:   "@prefix ex: <http://ex.org/> .\nex:s ex:p ex:o .",
+			triples: []string{"<http://ex.org/s> <http://ex.org/p> <http://ex.org/o>"},
+		},
+		{
+			name:    "SPARQL prefix without dot",
+			input:   "PREFIX ex: <http://ex.org/>\nex:s ex:p ex:o .",
+			triples: []string{"<http://ex.org/s> <http://ex.org/p> <http://ex.org/o>"},
+		},
+		{
+			name:    "empty prefix",
+			input:   "@prefix : <http://ex.org/> .\n:s :p :o .",
+			triples: []string{"<http://ex.org/s> <http://ex.org/p> <http://ex.org/o>"},
+		},
+		{
+			name:    "base directive and relative IRIs",
+			input:   "@base <http://ex.org/dir/> .\n<s> <p> <../o> .",
+			triples: []string{"<http://ex.org/dir/s> <http://ex.org/dir/p> <http://ex.org/o>"},
+		},
+		{
+			name:    "SPARQL base",
+			input:   "BASE <http://ex.org/>\n<s> <p> <o> .",
+			triples: []string{"<http://ex.org/s> <http://ex.org/p> <http://ex.org/o>"},
+		},
+		{
+			name:    "a keyword",
+			input:   "@prefix ex: <http://ex.org/> .\nex:s a ex:C .",
+			triples: []string{"<http://ex.org/s> <" + testRDF + "type> <http://ex.org/C>"},
+		},
+		{
+			name:  "predicate object list",
+			input: "@prefix ex: <http://ex.org/> .\nex:s ex:p ex:o ; ex:q ex:r .",
+			triples: []string{
+				"<http://ex.org/s> <http://ex.org/p> <http://ex.org/o>",
+				"<http://ex.org/s> <http://ex.org/q> <http://ex.org/r>",
+			},
+		},
+		{
+			name:  "trailing and repeated semicolons",
+			input: "@prefix ex: <http://ex.org/> .\nex:s ex:p ex:o ;; ex:q ex:r ; .",
+			triples: []string{
+				"<http://ex.org/s> <http://ex.org/p> <http://ex.org/o>",
+				"<http://ex.org/s> <http://ex.org/q> <http://ex.org/r>",
+			},
+		},
+		{
+			name:  "object list",
+			input: "@prefix ex: <http://ex.org/> .\nex:s ex:p ex:o1, ex:o2 .",
+			triples: []string{
+				"<http://ex.org/s> <http://ex.org/p> <http://ex.org/o1>",
+				"<http://ex.org/s> <http://ex.org/p> <http://ex.org/o2>",
+			},
+		},
+		{
+			name:    "name followed by the end of the statement",
+			input:   "@prefix ex: <http://ex.org/> .\nex:s ex:p ex:o.",
+			triples: []string{"<http://ex.org/s> <http://ex.org/p> <http://ex.org/o>"},
+		},
+		{
+			name:    "escaped local name",
+			input:   "@prefix ex: <http://ex.org/> .\nex:s ex:p ex:a\\.b .",
+			triples: []string{"<http://ex.org/s> <http://ex.org/p> <http://ex.org/a.b>"},
+		},
+		{
+			name:    "local name with a dot",
+			input:   "@prefix ex: <http://ex.org/> .\nex:s ex:p ex:a.b .",
+			triples: []string{"<http://ex.org/s> <http://ex.org/p> <http://ex.org/a.b>"},
+		},
+		{
+			name:    "unicode escape in IRI",
+			input:   `<http://ex.org/s> <http://ex.org/p> <http://ex.org/caf\u00E9> .`,
+			triples: []string{"<http://ex.org/s> <http://ex.org/p> <http://ex.org/café>"},
+		},
+		{
+			name:    "blank node labels",
+			input:   "_:a <http://ex.org/p> _:b .",
+			triples: []string{"_:a <http://ex.org/p> _:b"},
+		},
+		{
+			name:  "blank node property list as object",
+			input: "@prefix ex: <http://ex.org/> .\nex:s ex:p [ ex:q ex:o ; ex:r ex:t ] .",
+			triples: []string{
+				"_:ttl1 <http://ex.org/q> <http://ex.org/o>",
+				"_:ttl1 <http://ex.org/r> <http://ex.org/t>",
+				"<http://ex.org/s> <http://ex.org/p> _:ttl1",
+			},
+		},
+		{
+			name:    "blank node property list as subject",
+			input:   "@prefix ex: <http://ex.org/> .\n[ ex:q ex:o ] ex:p ex:s .",
+			triples: []string{"_:ttl1 <http://ex.org/q> <http://ex.org/o>", "_:ttl1 <http://ex.org/p> <http://ex.org/s>"},
+		},
+		{
+			name:    "blank node property list alone",
+			input:   "@prefix ex: <http://ex.org/> .\n[ ex:q ex:o ] .",
+			triples: []string{"_:ttl1 <http://ex.org/q> <http://ex.org/o>"},
+		},
+		{
+			name:    "empty blank node",
+			input:   "@prefix ex: <http://ex.org/> .\nex:s ex:p [] .",
+			triples: []string{"<http://ex.org/s> <http://ex.org/p> _:ttl1"},
+		},
+		{
+			name:  "nested blank nodes",
+			input: "@prefix ex: <http://ex.org/> .\nex:s ex:p [ ex:q [ ex:r ex:o ] ] .",
+			triples: []string{
+				"_:ttl2 <http://ex.org/r> <http://ex.org/o>",
+				"_:ttl1 <http://ex.org/q> _:ttl2",
+				"<http://ex.org/s> <http://ex.org/p> _:ttl1",
+			},
+		},
+		{
+			name:  "collection",
+			input: "@prefix ex: <http://ex.org/> .\nex:s ex:p ( ex:a 1 ) .",
+			triples: []string{
+				"_:ttl1 <" + testRDF + "first> <http://ex.org/a>",
+				"_:ttl1 <" + testRDF + "rest> _:ttl2",
+				"_:ttl2 <" + testRDF + "first> \"1\"^^<" + testXSD + "integer>",
+				"_:ttl2 <" + testRDF + "rest> <" + testRDF + "nil>",
+				"<http://ex.org/s> <http://ex.org/p> _:ttl1",
+			},
+		},
+		{
+			name:    "empty collection",
+			input:   "@prefix ex: <http://ex.org/> .\nex:s ex:p () .",
+			triples: []string{"<http://ex.org/s> <http://ex.org/p> <" + testRDF + "nil>"},
+		},
+		{
+			name:    "language tag",
+			input:   `<http://ex.org/s> <http://ex.org/p> "chat"@fr-CA .`,
+			triples: []string{`<http://ex.org/s> <http://ex.org/p> "chat"@fr-CA`},
+		},
+		{
+			name:    "datatype IRI",
+			input:   `<http://ex.org/s> <http://ex.org/p> "2020-01-01"^^<http://www.w3.org/2001/XMLSchema#date> .`,
+			triples: []string{`<http://ex.org/s> <http://ex.org/p> "2020-01-01"^^<` + testXSD + `date>`},
+		},
+		{
+			name:    "datatype prefixed name",
+			input:   "@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .\n<http://ex.org/s> <http://ex.org/p> \"5\"^^xsd:int .",
+			triples: []string{`<http://ex.org/s> <http://ex.org/p> "5"^^<` + testXSD + `int>`},
+		},
+		{
+			name:  "numbers and booleans",
+			input: "@prefix ex: <http://ex.org/> .\nex:s ex:p -5, 2.5, 1e3, +1.5E-2, true, false .",
+			triples: []string{
+				`<http://ex.org/s> <http://ex.org/p> "-5"^^<` + testXSD + `integer>`,
+				`<http://ex.org/s> <http://ex.org/p> "2.5"^^<` + testXSD + `decimal>`,
+				`<http://ex.org/s> <http://ex.org/p> "1e3"^^<` + testXSD + `double>`,
+				`<http://ex.org/s> <http://ex.org/p> "+1.5E-2"^^<` + testXSD + `double>`,
+				`<http://ex.org/s> <http://ex.org/p> "true"^^<` + testXSD + `boolean>`,
+				`<http://ex.org/s> <http://ex.org/p> "false"^^<` + testXSD + `boolean>`,
+			},
+		},
+		{
+			name:    "integer followed by the end of the statement",
+			input:   "<http://ex.org/s> <http://ex.org/p> 42.",
+			triples: []string{`<http://ex.org/s> <http://ex.org/p> "42"^^<` + testXSD + `integer>`},
+		},
+		{
+			name:    "single quoted and empty strings",
+			input:   `<http://ex.org/s> <http://ex.org/p> 'it', "", '' .`,
+			triples: []string{`<http://ex.org/s> <http://ex.org/p> "it"`, `<http://ex.org/s> <http://ex.org/p> ""`, `<http://ex.org/s> <http://ex.org/p> ""`},
+		},
+		{
+			name:    "long string",
+			input:   "<http://ex.org/s> <http://ex.org/p> \"\"\"two\nlines with \"quotes\" and \"\"two\"\" quotes\"\"\" .",
+			triples: []string{`<http://ex.org/s> <http://ex.org/p> "two\nlines with \"quotes\" and \"\"two\"\" quotes"`},
+		},
+		{
+			name:    "long single quoted string",
+			input:   "<http://ex.org/s> <http://ex.org/p> '''it's''' .",
+			triples: []string{`<http://ex.org/s> <http://ex.org/p> "it's"`},
+		},
+		{
+			name:    "escapes",
+			input:   `<http://ex.org/s> <http://ex.org/p> "a\tb\"c\\dé\U0001F600\n" .`,
+			triples: []string{"<http://ex.org/s> <http://ex.org/p> \"a\tb\\\"c\\\\dé😀\\n\""},
+		},
+		{
+			name:    "comments",
+			input:   "# header\n<http://ex.org/s> <http://ex.org/p> <http://ex.org/o> . # trailing\n# end",
+			triples: []string{"<http://ex.org/s> <http://ex.org/p> <http://ex.org/o>"},
+		},
+		{
+			name:    "empty document",
+			input:   "  \n# only a comment\n",
+			triples: []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			triples, err := scanTurtle(test.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(triples, "\n") != strings.Join(test.triples, "\n") {
+				t.Errorf("got triples\n%s\nwant\n%s", strings.Join(triples, "\n"), strings.Join(test.triples, "\n"))
+			}
+		})
+	}
+}
+
+func TestTurtleScannerErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		// triples is the number of triples handed out before the error.
+		triples int
+		err     string
+	}{
+		{"undefined prefix", "ex:s ex:p ex:o .", 0, `line 1: undefined prefix "ex"`},
+		{"missing dot", "<http://ex.org/s> <http://ex.org/p> <http://ex.org/o>", 1, `expected ".", found end of file`},
+		{"missing dot after prefix", "@prefix ex: <http://ex.org/>\nex:s ex:p ex:o .", 0, `line 2: expected ".", found "ex:s"`},
+		{"prefix without name", "@prefix <http://ex.org/> .", 0, `expected prefix name`},
+		{"prefix without IRI", "@prefix ex: ex:o .", 0, `expected IRI for prefix ex:`},
+		{"base without IRI", "@base ex:o .", 0, `expected base IRI`},
+		{"literal subject", `"s" <http://ex.org/p> <http://ex.org/o> .`, 0, `unexpected "s"`},
+		{"literal predicate", `<http://ex.org/s> "p" <http://ex.org/o> .`, 0, `expected predicate, found "p"`},
+		{"unterminated IRI", "<http://ex.org/s", 0, `unterminated token, expected '>'`},
+		{"unterminated string", `<http://ex.org/s> <http://ex.org/p> "o`, 0, `unterminated string`},
+		{"unterminated long string", `<http://ex.org/s> <http://ex.org/p> """o""`, 0, `unterminated string`},
+		{"line break in string", "<http://ex.org/s> <http://ex.org/p> \"o\n\" .", 0, `line 2: line break in string`},
+		{"invalid escape", `<http://ex.org/s> <http://ex.org/p> "\q" .`, 0, `invalid escape sequence \q`},
+		{"invalid unicode escape", `<http://ex.org/s> <http://ex.org/p> "\u00ZZ" .`, 0, `invalid unicode escape \u00ZZ`},
+		{"single caret", `<http://ex.org/s> <http://ex.org/p> "o"^<http://ex.org/t> .`, 0, `expected '^^'`},
+		{"literal datatype", `<http://ex.org/s> <http://ex.org/p> "o"^^"t" .`, 0, `expected datatype IRI, found "t"`},
+		{"blank node without colon", "_a <http://ex.org/p> <http://ex.org/o> .", 0, `expected '_:'`},
+		{"invalid number", "<http://ex.org/s> <http://ex.org/p> - .", 0, `invalid number "-"`},
+		{"unexpected character", "<http://ex.org/s> <http://ex.org/p> {} .", 0, `unexpected character '{'`},
+		{"unknown keyword", "<http://ex.org/s> <http://ex.org/p> maybe .", 0, `unexpected "maybe"`},
+		{"unclosed blank node", "<http://ex.org/s> <http://ex.org/p> [ <http://ex.org/q> <http://ex.org/o> .", 1, `expected "]", found "."`},
+		{"unclosed collection", "<http://ex.org/s> <http://ex.org/p> ( <http://ex.org/o>", 1, `unexpected ""`},
+		{
+			name:    "triples before the error are handed out",
+			input:   "<http://ex.org/s> <http://ex.org/p> <http://ex.org/o> .\n<http://ex.org/s> <http://ex.org/p> \"o\n",
+			triples: 1,
+			err:     "test.ttl line 3: line break in string",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			triples, err := scanTurtle(test.input)
+			if err == nil {
+				t.Fatalf("expected an error containing %q, got triples %v", test.err, triples)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %q, want it to contain %q", err, test.err)
+			}
+			if len(triples) != test.triples {
+				t.Errorf("got %d triples before the error, want %d", len(triples), test.triples)
+			}
+		})
+	}
+}
+
+func TestTurtleScannerLine(t *testing.T) {
+	scanner := newTurtleScanner(bufio.NewReader(strings.NewReader(
+		"# comment\n\n<http://ex.org/s> <http://ex.org/p> <http://ex.org/o> .\n<http://ex.org/s> <http://ex.org/p>\n  <http://ex.org/o> .\n")), "test.ttl")
+	lines := []int{}
+	for scanner.Scan() {
+		lines = append(lines, scanner.Line())
+	}
+	if scanner.Err() != nil {
+		t.Fatalf("unexpected error: %v", scanner.Err())
+	}
+	// The line is where the scanner stopped reading, after the statement's last token.
+	if len(lines) != 2 || lines[0] != 3 || lines[1] != 5 {
+		t.Errorf("got lines %v, want [3 5]", lines)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// validationReportPath is where the JSON validation report is written.
+var validationReportPath = "validation.json"
+
+// validationExamples is how many failing URIs are listed per check, collection and taxon.
+var validationExamples = 10
+
+// ValidationResult is the outcome of one check for the documents of one taxon in one collection.
+// Only results with failing documents are reported.
+type ValidationResult struct {
+	Check      string   `json:"check"`
+	Collection string   `json:"collection"`
+	Taxon      string   `json:"taxon,omitempty"`
+	Checked    int      `json:"checked"`
+	Failed     int      `json:"failed"`
+	Fraction   float64  `json:"fraction"`
+	Threshold  *float64 `json:"threshold,omitempty"`
+	Exceeded   bool     `json:"exceeded"`
+	Examples   []string `json:"examples"`
+}
+
+type ValidationReport struct {
+	Passed  bool               `json:"passed"`
+	Results []ValidationResult `json:"results"`
+}
+
+// validationCheck finds the failing documents of a collection. Most checks are a filter on the documents,
+// find is used for the ones that need other collections.
+type validationCheck struct {
+	name        string
+	description string
+	kinds       []string
+	collections []string
+	filter      bson.M
+	find        func(ctx context.Context, db *mongo.Database, collection string) ([]failedDocument, error)
+}
+
+type failedDocument struct {
+	URI   string      `bson:"uri"`
+	Taxon interface{} `bson:"taxon"`
+}
+
+var emptyValues = bson.A{"", nil}
+
+var validationChecks = []validationCheck{
+	{
+		name:        "missingLabel",
+		description: "documents without prefLabel",
+		kinds:       []string{"entity", "ontology"},
+		filter:      bson.M{"prefLabel": bson.M{"$in": emptyValues}},
+	},
+	{
+		name:        "danglingEncodes",
+		description: "genes encoding proteins that are not in the prot collection",
+		collections: []string{"gene"},
+		find:        findDanglingEncodes,
+	},
+	{
+		name:        "emptyEndpoint",
+		description: "statements without subject or object",
+		kinds:       []string{""},
+		filter:      bson.M{"$or": bson.A{bson.M{"subject": bson.M{"$in": emptyValues}}, bson.M{"object": bson.M{"$in": emptyValues}}}},
+	},
+	{
+		name:        "missingDefinition",
+		description: "GO terms without definition, apart from deprecated ones",
+		collections: []string{"goall"},
+		filter:      bson.M{"definition": bson.M{"$in": emptyValues}, "deprecated": bson.M{"$ne": true}},
+	},
+}
+
+// appliesTo is true if the check is run on a collection.
+func (c validationCheck) appliesTo(collection string) bool {
+	for _, name := range c.collections {
+		if name == collection {
+			return true
+		}
+	}
+	for _, kind := range c.kinds {
+		if collectionKinds[collection] == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// validateBuild runs the checks on the loaded collections, writes the JSON report, prints the human-readable one,
+// and returns an error if any check exceeds its threshold in the manifest.
+func validateBuild(ctx context.Context, client *mongo.Client) error {
+	db := client.Database("metadb")
+	report := ValidationReport{Passed: true, Results: []ValidationResult{}}
+	for _, check := range validationChecks {
+		for _, collection := range loadedCollections() {
+			if !check.appliesTo(collection) {
+				continue
+			}
+			results, err := runCheck(ctx, db, check, collection)
+			if err != nil {
+				panic(err)
+			}
+			for _, result := range results {
+				report.Passed = report.Passed && !result.Exceeded
+				report.Results = append(report.Results, result)
+			}
+		}
+	}
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile(validationReportPath, content, 0644); err != nil {
+		slog.Error("Error writing validation report", "file", validationReportPath, "err", err)
+	}
+	printValidationReport(report)
+	if !report.Passed {
+		return fmt.Errorf("validation checks exceeded their threshold in the manifest, see %s", validationReportPath)
+	}
+	return nil
+}
+
+func runCheck(ctx context.Context, db *mongo.Database, check validationCheck, collection string) ([]ValidationResult, error) {
+	var failed []failedDocument
+	var err error
+	if check.find != nil {
+		failed, err = check.find(ctx, db, collection)
+	} else {
+		failed, err = findFailedDocuments(ctx, db.Collection(collection), check.filter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %s check: %w", collection, check.name, err)
+	}
+	if len(failed) == 0 {
+		return nil, nil
+	}
+	checked, err := countByTaxon(ctx, db.Collection(collection))
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %s check: %w", collection, check.name, err)
+	}
+
+	byTaxon := make(map[string]*ValidationResult)
+	for _, document := range failed {
+		taxon := strings.TrimPrefix(firstTaxon(document.Taxon), taxonPrefix)
+		result, ok := byTaxon[taxon]
+		if !ok {
+			result = &ValidationResult{Check: check.name, Collection: collection, Taxon: taxon, Checked: checked[taxon], Examples: []string{}}
+			byTaxon[taxon] = result
+		}
+		result.Failed++
+		if len(result.Examples) < validationExamples {
+			result.Examples = append(result.Examples, document.URI)
+		}
+	}
+
+	taxa := make([]string, 0, len(byTaxon))
+	for taxon := range byTaxon {
+		taxa = append(taxa, taxon)
+	}
+	sort.Strings(taxa)
+	results := []ValidationResult{}
+	for _, taxon := range taxa {
+		result := byTaxon[taxon]
+		if result.Checked > 0 {
+			result.Fraction = float64(result.Failed) / float64(result.Checked)
+		}
+		if threshold, ok := manifest.ValidationThresholds[check.name]; ok {
+			result.Threshold = &threshold
+			result.Exceeded = result.Fraction > threshold
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
+
+func findFailedDocuments(ctx context.Context, collection *mongo.Collection, filter bson.M) ([]failedDocument, error) {
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 0, "uri": 1, "taxon": 1}))
+	if err != nil {
+		return nil, err
+	}
+	failed := []failedDocument{}
+	err = cursor.All(ctx, &failed)
+	return failed, err
+}
+
+// findDanglingEncodes returns the genes with an encodes entry that is not in the prot collection.
+func findDanglingEncodes(ctx context.Context, db *mongo.Database, collection string) ([]failedDocument, error) {
+	cursor, err := db.Collection("prot").Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"_id": 0, "uri": 1}))
+	if err != nil {
+		return nil, err
+	}
+	prots := make(map[string]bool)
+	for cursor.Next(ctx) {
+		var prot failedDocument
+		if err := cursor.Decode(&prot); err != nil {
+			cursor.Close(ctx)
+			return nil, err
+		}
+		prots[prot.URI] = true
+	}
+	cursor.Close(ctx)
+
+	cursor, err = db.Collection(collection).Find(ctx,
+		bson.M{"encodes.0": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"_id": 0, "uri": 1, "taxon": 1, "encodes": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	failed := []failedDocument{}
+	for cursor.Next(ctx) {
+		var gene struct {
+			URI     string      `bson:"uri"`
+			Taxon   interface{} `bson:"taxon"`
+			Encodes []string    `bson:"encodes"`
+		}
+		if err := cursor.Decode(&gene); err != nil {
+			return nil, err
+		}
+		for _, prot := range gene.Encodes {
+			if !prots[prot] {
+				failed = append(failed, failedDocument{URI: gene.URI, Taxon: gene.Taxon})
+				break
+			}
+		}
+	}
+	return failed, cursor.Err()
+}
+
+// countByTaxon counts the documents of a collection per taxon ID. Documents without taxon are counted under "".
+func countByTaxon(ctx context.Context, collection *mongo.Collection) (map[string]int, error) {
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$taxon", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	counts := make(map[string]int)
+	for cursor.Next(ctx) {
+		var result struct {
+			Taxon interface{} `bson:"_id"`
+			Count int         `bson:"count"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+		counts[strings.TrimPrefix(firstTaxon(result.Taxon), taxonPrefix)] += result.Count
+	}
+	return counts, cursor.Err()
+}
+
+// printValidationReport logs each result, as an error if it exceeded its threshold.
+func printValidationReport(report ValidationReport) {
+	descriptions := make(map[string]string)
+	for _, check := range validationChecks {
+		descriptions[check.name] = check.description
+	}
+	if len(report.Results) == 0 {
+		slog.Info("No issues found", "phase", "validate")
+	}
+	for _, result := range report.Results {
+		level := slog.LevelWarn
+		attributes := []any{"phase", "validate", "check", result.Check, "graph", result.Collection}
+		if result.Taxon != "" {
+			attributes = append(attributes, "taxon", result.Taxon)
+		}
+		attributes = append(attributes, "count", result.Failed, "checked", result.Checked, "fraction", result.Fraction)
+		if result.Exceeded {
+			level = slog.LevelError
+			attributes = append(attributes, "threshold", *result.Threshold)
+		}
+		attributes = append(attributes, "examples", result.Examples)
+		slog.Log(context.Background(), level, descriptions[result.Check], attributes...)
+	}
+	slog.Info("Validation report written", "phase", "validate", "file", validationReportPath)
+}
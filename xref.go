@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// xrefCollection is the collection mapping identifiers of other databases to BioGateway URIs.
+var xrefCollection = "xref"
+
+// Xref is an identifier of an entity in another database, as an IRI or as a prefixed ID like NCBIGene:7157.
+type Xref struct {
+	id    string
+	match string
+}
+
+// addXref returns the xrefs with the object of an xref predicate added, unless it is already there.
+func addXref(xrefs []Xref, value string, match string) []Xref {
+	id := strings.TrimSpace(removeLTGT(value))
+	if id == "" {
+		return xrefs
+	}
+	for _, xref := range xrefs {
+		if xref.id == id {
+			return xrefs
+		}
+	}
+	return append(xrefs, Xref{id: id, match: match})
+}
+
+// xrefIDs returns the IDs of the xrefs, for the xrefs array of the entity documents.
+func xrefIDs(xrefs []Xref) []string {
+	ids := []string{}
+	for _, xref := range xrefs {
+		ids = append(ids, xref.id)
+	}
+	return ids
+}
+
+// splitXref splits an xref into its namespace and local ID: the prefix of a prefixed ID, the prefix of an IRI
+// in the manifest's prefix map, or else the IRI up to the last / or #.
+func splitXref(id string) (string, string) {
+	if strings.Contains(id, "://") {
+		if curie, localID, ok := manifest.compactIRI(id); ok {
+			return strings.TrimSuffix(curie, ":"+localID), localID
+		}
+		index := strings.LastIndexAny(id, "/#")
+		return id[:index+1], id[index+1:]
+	}
+	if namespace, localID, ok := strings.Cut(id, ":"); ok {
+		return namespace, localID
+	}
+	return "", id
+}
+
+// insertXrefsToDB adds the xrefs of an entity to the xref collection. taxon is nil for entities without a taxon.
+func insertXrefsToDB(ctx context.Context, xrefDB *mongo.Collection, uri string, graph string, taxon interface{}, xrefs []Xref) {
+	updateOptions := options.Update().SetUpsert(true)
+	for _, xref := range xrefs {
+		namespace, localID := splitXref(xref.id)
+		doc := bson.M{
+			"xref":       xref.id,
+			"namespace":  namespace,
+			"localId":    localID,
+			"match":      xref.match,
+			"uri":        uri,
+			"collection": graph,
+		}
+		if taxon != nil {
+			doc["taxon"] = taxon
+		}
+		_, err := xrefDB.UpdateOne(
+			ctx,
+			bson.M{"xref": xref.id, "uri": uri},
+			bson.M{"$set": doc},
+			updateOptions)
+		if interruptedWrite(ctx, err) {
+			return
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+}